@@ -1,11 +1,10 @@
 package client
 
 import (
+	"context"
 	"errors"
-	"log"
-	"net"
-	"strconv"
-	"strings"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
@@ -13,12 +12,33 @@ import (
 	"go.uber.org/atomic"
 )
 
-var defaultOpts *Options
+// 等待回执超时后，发送断开包的写入超时时间
+const disconnectWriteTimeout = time.Second
 
-func init() {
-	defaultOpts = NewOptions()
-	// flagSet := lmFlagSet(defaultOpts)
-	// flagSet.Parse(os.Args[1:])
+var (
+	// ErrClosed 客户端已关闭
+	ErrClosed = errors.New("客户端已关闭！")
+	// ErrNotConnected 还没有连接
+	ErrNotConnected = errors.New("还没有连接！")
+	// ErrAckTimeout 重发次数用完仍没有收到发送回执
+	ErrAckTimeout = errors.New("等待发送回执超时！")
+	// ErrKicked 被服务端踢下线
+	ErrKicked = errors.New("被踢下线！")
+)
+
+// KickedError 被服务端断开的原因
+type KickedError struct {
+	ReasonCode lmproto.ReasonCode
+	Reason     string
+}
+
+func (e *KickedError) Error() string {
+	return fmt.Sprintf("被踢下线！[%s]%s", e.ReasonCode, e.Reason)
+}
+
+// Is 支持errors.Is(err, ErrKicked)
+func (e *KickedError) Is(target error) bool {
+	return target == ErrKicked
 }
 
 // OnRecv 收到消息事件
@@ -30,62 +50,202 @@ type OnSendack func(sendack *lmproto.SendackPacket)
 // OnClose 连接关闭
 type OnClose func()
 
+// OnSendFailed 消息重发次数用完仍没有收到发送回执
+type OnSendFailed func(packet *lmproto.SendPacket, err error)
+
+// OnKicked 被服务端断开(踢下线)
+type OnKicked func(reasonCode lmproto.ReasonCode, reason string)
+
 // Client 狸猫客户端
 type Client struct {
-	opts              *Options              // 狸猫IM配置
-	sending           []*lmproto.SendPacket // 发送中的包
-	proto             *lmproto.LiMaoProto
-	addr              string      // 连接地址
-	connected         atomic.Bool // 是否已连接
-	conn              net.Conn
-	heartbeatTimer    *time.Timer // 心跳定时器
-	stopHeartbeatChan chan bool
-	retryPingCount    int // 重试ping次数
-	clientIDGen       atomic.Uint64
-	onRecv            OnRecv
-	onClose           OnClose
-	onSendack         OnSendack
-	sendTotalMsgBytes atomic.Int64 // 发送消息总bytes数
-}
-
-// New 创建客户端
+	opts               *Options      // 狸猫IM配置
+	outbox             Outbox        // 发件箱，保存发送中的包
+	sendingDrainChan   chan struct{} // 有发送中的包收到回执时通知
+	closing            atomic.Bool   // 正在断开，不再接受新消息
+	proto              *lmproto.LiMaoProto
+	addr               string       // 连接地址
+	state              atomic.Int32 // 连接状态
+	stateLock          sync.Mutex
+	conn               Conn
+	connLock           sync.RWMutex
+	writer             *connWriter    // 当前连接的写入者
+	closeChan          chan struct{}  // 客户端关闭后不再重连
+	pongChan           chan time.Time // 收到pong的时间
+	rtt                RTTStats       // ping/pong往返时间
+	rttLock            sync.Mutex
+	timeDiff           atomic.Int64 // 客户端时间与服务器的差值，单位毫秒
+	clientIDGen        atomic.Uint64
+	onRecv             OnRecv
+	onClose            OnClose
+	onSendack          OnSendack
+	onStateChange      OnStateChange
+	onKicked           OnKicked
+	logger             Logger
+	onSendFailed       OnSendFailed
+	retransmits        map[uint64]*retransmit // 等待回执的消息的重发状态，key为ClientSeq
+	retransmitsLock    sync.Mutex
+	closeErr           error                         // 客户端关闭的原因
+	sendackWaiters     map[uint64]chan sendackResult // 等待发送回执的消息，key为ClientSeq
+	sendackWaitersLock sync.Mutex
+	sendTotalMsgBytes  atomic.Int64 // 发送消息总bytes数
+	stats              *clientStats
+	subscriptions      *subscriptions // 频道订阅
+	messages           *messageStream // 收到的消息流
+	acks               *ackStream     // 发送回执流
+	sequencer          *sequencer     // 有序投递，没有开启时为nil
+	onGap              OnGap
+	recvacks           *recvackBatcher // 批量回执，没有开启时为nil
+	workers            *recvWorkers    // 并发处理收到的消息，没有开启时为nil
+	limiter            *rateLimiter    // 发送限速，没有开启时为nil
+}
+
+// New 创建客户端，每个客户端有自己的配置
 func New(addr string, opts ...Option) *Client {
+	clientOpts := NewOptions()
 	for _, opt := range opts {
 		if opt != nil {
-			if err := opt(defaultOpts); err != nil {
+			if err := opt(clientOpts); err != nil {
 				panic(err)
 			}
 		}
 	}
-	return &Client{
-		opts:              defaultOpts,
-		addr:              addr,
-		sending:           make([]*lmproto.SendPacket, 0),
-		proto:             lmproto.New(),
-		heartbeatTimer:    time.NewTimer(time.Second * 20),
-		stopHeartbeatChan: make(chan bool, 0),
+	c := &Client{
+		opts:             clientOpts,
+		addr:             addr,
+		outbox:           clientOpts.Outbox,
+		proto:            lmproto.New(),
+		pongChan:         make(chan time.Time, 1),
+		closeChan:        make(chan struct{}),
+		sendingDrainChan: make(chan struct{}, 1),
+		sendackWaiters:   make(map[uint64]chan sendackResult),
+		retransmits:      make(map[uint64]*retransmit),
+		stats:            newClientStats(clientOpts.RecvQueueWaitBuckets),
+		subscriptions:    newSubscriptions(),
+	}
+	c.messages = newMessageStream(clientOpts.StreamBufferSize, clientOpts.StreamPolicy, c.closeChan)
+	c.acks = newAckStream(clientOpts.StreamBufferSize, clientOpts.StreamPolicy, c.closeChan)
+	c.limiter = newRateLimiter(clientOpts.RateLimit, clientOpts.ChannelRateLimits)
+	if clientOpts.RecvWorkers > 0 {
+		c.workers = newRecvWorkers(clientOpts.RecvWorkers, clientOpts.RecvQueueSize, c.processRecv, c.stats.recvQueueWait, c.closeChan)
+	}
+	if clientOpts.RecvackBatchSize > 0 && clientOpts.RecvackBatchDelay > 0 {
+		c.recvacks = newRecvackBatcher(clientOpts.RecvackBatchSize, clientOpts.RecvackBatchDelay, c.flushRecvacks)
 	}
+	if clientOpts.OrderWindow > 0 {
+		c.sequencer = newSequencer(clientOpts.OrderWindow, c.deliverRecv, c.sendRecvack, c.handleGap)
+	}
+	if c.outbox == nil {
+		c.outbox = NewMemoryOutbox()
+	}
+	c.logger = withFields(clientOpts.Logger, "uid", clientOpts.UID)
+	// 发件箱里有上次没发送成功的消息时，新消息的ClientSeq从最大的ClientSeq开始
+	packets, err := c.outbox.List()
+	if err != nil {
+		panic(err)
+	}
+	for _, packet := range packets {
+		if packet.ClientSeq > c.clientIDGen.Load() {
+			c.clientIDGen.Store(packet.ClientSeq)
+		}
+	}
+	return c
 }
 
 // Connect 连接到IM
 func (c *Client) Connect() error {
-	network, address, _ := parseAddr(c.addr)
-	var err error
-	c.conn, err = net.Dial(network, address)
+	return c.ConnectContext(context.Background())
+}
+
+// ConnectContext 连接到IM，ctx的取消和截止时间作用于拨号和握手阶段
+func (c *Client) ConnectContext(ctx context.Context) error {
+	return c.connect(ctx, StateIdle)
+}
+
+// 建立连接，失败时切换到fallback状态
+func (c *Client) connect(ctx context.Context, fallback State) error {
+	if err := c.setState(StateDialing, nil); err != nil {
+		if c.State() == StateClosed {
+			return ErrClosed
+		}
+		return err
+	}
+	conn, err := c.dial(ctx)
 	if err != nil {
+		err = connectError(ConnectPhaseDial, err)
+		c.setState(fallback, err)
+		return err
+	}
+	writer := newConnWriter(conn, c.opts.WriteQueueSize)
+	c.connLock.Lock()
+	c.conn = conn
+	c.writer = writer
+	c.connLock.Unlock()
+
+	if err = c.setState(StateHandshaking, nil); err != nil {
+		conn.Close()
+		writer.close()
+		return ErrClosed // 只有关闭客户端会打断连接过程
+	}
+	unbind := bindContext(ctx, conn.SetDeadline)
+	err = c.handshake(ctx)
+	if ctxErr := unbind(); err != nil {
+		conn.Close()
+		writer.close()
+		if ctxErr != nil {
+			err = ctxErr
+		}
+		err = connectError(ConnectPhaseConnack, err)
+		c.setState(fallback, err)
 		return err
 	}
-	err = c.sendPacket(&lmproto.ConnectPacket{
+	if err = c.setState(StateConnected, nil); err != nil {
+		conn.Close()
+		writer.close()
+		return ErrClosed
+	}
+
+	// 重发发件箱里的消息
+	sending, err := c.outbox.List()
+	if err != nil {
+		c.logger.Error("获取发件箱消息失败！", "error", err)
+	}
+	if len(sending) > 0 {
+		c.logger.Info("重发发件箱里的消息", "count", len(sending))
+	}
+	if c.limiter == nil {
+		c.resendOutbox(sending)
+	}
+	stopHeartbeatChan := make(chan struct{})
+	go c.loopConn(conn, writer, stopHeartbeatChan)
+	go c.loopPing(conn, stopHeartbeatChan)
+	if c.limiter != nil {
+		go c.resendOutbox(sending) // 重发也要等待限速，不能阻塞连接和心跳
+	}
+	return nil
+}
+
+// 重发发件箱里的消息
+func (c *Client) resendOutbox(sending []*lmproto.SendPacket) {
+	for _, packet := range sending {
+		c.stats.markSent(packet.ClientSeq)
+		opts := c.ensureRetransmit(packet)
+		c.resendPacket(packet, opts.Priority)
+	}
+}
+
+// 握手，发送连接包并等待连接回执
+func (c *Client) handshake(ctx context.Context) error {
+	err := c.sendPacketContext(ctx, &lmproto.ConnectPacket{
 		Version:         c.opts.ProtoVersion,
 		DeviceFlag:      lmproto.WEB,
-		ClientTimestamp: time.Now().Unix(),
+		ClientTimestamp: time.Now().UnixNano() / int64(time.Millisecond),
 		UID:             c.opts.UID,
 		Token:           c.opts.Token,
 	})
 	if err != nil {
 		return err
 	}
-	f, err := c.proto.DecodePacketWithConn(c.conn, c.opts.ProtoVersion)
+	f, err := c.readPacket(c.getConn())
 	if err != nil {
 		return err
 	}
@@ -94,44 +254,199 @@ func (c *Client) Connect() error {
 		return errors.New("返回包类型有误！不是连接回执包！")
 	}
 	if connack.ReasonCode != lmproto.ReasonSuccess {
-		return errors.New("连接失败！")
+		c.logger.Warn("连接被服务端拒绝！", "reasonCode", connack.ReasonCode)
+		return fmt.Errorf("连接被服务端拒绝[%s]！", connack.ReasonCode)
+	}
+	c.timeDiff.Store(connack.TimeDiff)
+	return nil
+}
+
+// Disconnect 断开IM，断开后不再重连
+// 断开前会停止接受新消息，并在ctx结束前等待发送中的消息收到回执，然后发送断开包再关闭连接
+// 如果ctx结束时仍有消息没有收到回执，返回ctx的错误
+func (c *Client) Disconnect(ctx context.Context, reasonCode lmproto.ReasonCode, reason string) error {
+	if !c.closing.CAS(false, true) {
+		return ErrClosed
 	}
-	if len(c.sending) > 0 {
-		for _, packet := range c.sending {
-			c.sendPacket(packet)
+	var err error
+	if c.State() == StateConnected {
+		err = c.waitSendingDrain(ctx)
+		writeCtx := ctx
+		if ctx.Err() != nil { // 等待回执已超时，断开包仍然尝试发送
+			var cancel context.CancelFunc
+			writeCtx, cancel = context.WithTimeout(context.Background(), disconnectWriteTimeout)
+			defer cancel()
+		}
+		// 攒着的消息回执和断开包一起发送
+		packets := append(c.takeRecvacks(), &lmproto.DisconnectPacket{
+			ReasonCode: reasonCode,
+			Reason:     reason,
+		})
+		disconnectErr := c.sendPacketsContext(writeCtx, packets...)
+		if err == nil {
+			err = disconnectErr
 		}
 	}
-	go c.loopConn()
-	go c.loopPing()
-	return nil
+	if !c.close(nil) {
+		return ErrClosed
+	}
+	if conn := c.getConn(); conn != nil {
+		conn.Close()
+	}
+	return err
 }
 
-// Disconnect 断开IM
-func (c *Client) Disconnect() {
-	c.handleClose()
+// 等待发送中的包全部收到回执
+func (c *Client) waitSendingDrain(ctx context.Context) error {
+	for {
+		if c.outbox.Len() == 0 {
+			return nil
+		}
+		select {
+		case <-c.sendingDrainChan:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 }
 
-func (c *Client) handleClose() {
-	if c.connected.Load() {
-		c.connected.Store(false)
-		c.conn.Close()
-		if c.onClose != nil {
-			c.onClose()
+// 切换到关闭状态并停止重连，已经关闭时返回false
+func (c *Client) close(cause error) bool {
+	err := c.changeState(StateClosed, cause, func() {
+		c.closeErr = cause
+	})
+	if err != nil {
+		return false
+	}
+	close(c.closeChan)
+	c.messages.close()
+	c.acks.close()
+	if c.sequencer != nil {
+		c.sequencer.stop()
+	}
+	c.takeRecvacks() // 没发出去的回执丢弃，服务端会重新投递
+	c.stopAllRetransmits()
+	c.cancelSendackWaiters()
+	if err := c.outbox.Close(); err != nil {
+		c.logger.Error("关闭发件箱失败！", "error", err)
+	}
+	if c.opts.Deduper != nil {
+		if err := c.opts.Deduper.Close(); err != nil {
+			c.logger.Error("关闭去重窗口失败！", "error", err)
 		}
 	}
+	return true
+}
+
+// Err 客户端关闭的原因，被踢下线时为*KickedError(errors.Is(err, ErrKicked)为true)，主动断开或未关闭时为nil
+func (c *Client) Err() error {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	return c.closeErr
+}
+
+// 获取当前连接
+func (c *Client) getConn() Conn {
+	c.connLock.RLock()
+	defer c.connLock.RUnlock()
+	return c.conn
+}
+
+// 获取当前连接的写入者
+func (c *Client) getWriter() *connWriter {
+	c.connLock.RLock()
+	defer c.connLock.RUnlock()
+	return c.writer
+}
+
+func (c *Client) handleClose(conn Conn) {
+	conn.Close()
+	if c.onClose != nil {
+		c.onClose()
+	}
 }
 
 // SendMessage 发送消息
-func (c *Client) SendMessage(channel *Channel, payload []byte) error {
-	packet := &lmproto.SendPacket{
+func (c *Client) SendMessage(channel *Channel, payload []byte, opts ...SendOption) error {
+	return c.SendMessageContext(context.Background(), channel, payload, opts...)
+}
+
+// SendMessageContext 发送消息，ctx的取消和截止时间作用于写入阶段
+// 如果因ctx结束而没有发送成功，消息不会在重连后补发
+func (c *Client) SendMessageContext(ctx context.Context, channel *Channel, payload []byte, opts ...SendOption) error {
+	sendOpts, err := c.buildSendOptions(opts)
+	if err != nil {
+		return err
+	}
+	return c.sendMessage(ctx, c.newSendPacket(channel, payload), sendOpts)
+}
+
+// 生成单条消息的发送配置
+func (c *Client) buildSendOptions(opts []SendOption) (*SendOptions, error) {
+	sendOpts := newSendOptions(c.opts)
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(sendOpts); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return sendOpts, nil
+}
+
+// 创建发送包
+func (c *Client) newSendPacket(channel *Channel, payload []byte) *lmproto.SendPacket {
+	return &lmproto.SendPacket{
 		ClientSeq:   c.clientIDGen.Add(1),
 		ClientMsgNo: util.GenUUID(),
 		ChannelID:   channel.ChannelID,
 		ChannelType: channel.ChannelType,
 		Payload:     payload,
 	}
-	c.sending = append(c.sending, packet)
-	return c.sendPacket(packet)
+}
+
+// 发送消息，发送后加入发送中的包，直到收到回执或重发失败
+func (c *Client) sendMessage(ctx context.Context, packet *lmproto.SendPacket, opts *SendOptions) error {
+	if c.closing.Load() || c.State() == StateClosed {
+		return ErrClosed
+	}
+	sent := false
+	handler := chainSendInterceptors(c.opts.SendInterceptors, func(ctx context.Context, packet *lmproto.SendPacket) error {
+		sent = true
+		if c.limiter != nil {
+			waited, err := c.limiter.wait(ctx, packet, opts.RateLimitFailFast)
+			if err != nil {
+				if err == ErrRateLimited {
+					c.stats.rateLimited.Inc()
+				}
+				return err
+			}
+			c.stats.rateLimitWait.observe(waited)
+		}
+		if err := c.outbox.Add(packet); err != nil {
+			return err
+		}
+		c.stats.markSent(packet.ClientSeq)
+		c.startRetransmit(packet, opts)
+		err := c.sendPacketsPriority(ctx, opts.Priority, packet)
+		if err != nil && ctx.Err() != nil {
+			c.stopRetransmit(packet.ClientSeq)
+			c.removeSending(packet.ClientSeq)
+		}
+		return err
+	})
+	if err := handler(ctx, packet); err != nil {
+		return err
+	}
+	if !sent {
+		return ErrMessageDropped
+	}
+	return nil
+}
+
+// UID 客户端的用户uid
+func (c *Client) UID() string {
+	return c.opts.UID
 }
 
 // SetOnRecv 设置收消息事件
@@ -144,6 +459,16 @@ func (c *Client) SetOnClose(onClose OnClose) {
 	c.onClose = onClose
 }
 
+// SetOnKicked 设置被踢下线事件
+func (c *Client) SetOnKicked(onKicked OnKicked) {
+	c.onKicked = onKicked
+}
+
+// SetOnSendFailed 设置消息发送失败事件
+func (c *Client) SetOnSendFailed(onSendFailed OnSendFailed) {
+	c.onSendFailed = onSendFailed
+}
+
 // SetOnSendack 设置发送回执
 func (c *Client) SetOnSendack(onSendack OnSendack) {
 	c.onSendack = onSendack
@@ -154,57 +479,168 @@ func (c *Client) GetSendMsgBytes() int64 {
 	return c.sendTotalMsgBytes.Load()
 }
 
-func (c *Client) loopPing() {
-	for {
-		select {
-		case <-c.heartbeatTimer.C:
-			if c.retryPingCount >= 3 {
-				c.conn.Close() // 如果重试三次没反应就断开连接，让其重连
-				return
-			}
-			c.ping()
-			c.retryPingCount++
+// 发送包
+func (c *Client) sendPacket(packet lmproto.Frame) error {
+	return c.sendPacketContext(context.Background(), packet)
+}
+
+// 发送包，ctx结束时中断写入
+func (c *Client) sendPacketContext(ctx context.Context, packet lmproto.Frame) error {
+	return c.sendPacketsContext(ctx, packet)
+}
+
+// 在一次写入中发送多个包，消息包走交互通道，其他的控制包走控制通道
+func (c *Client) sendPacketsContext(ctx context.Context, packets ...lmproto.Frame) error {
+	priority := PriorityControl
+	for _, packet := range packets {
+		if packet.GetPacketType() == lmproto.SEND {
+			priority = PriorityInteractive
 			break
-		case <-c.stopHeartbeatChan:
-			goto exit
 		}
 	}
-exit:
+	return c.sendPacketsPriority(ctx, priority, packets...)
 }
 
-func (c *Client) ping() {
-	c.sendPacket(&lmproto.PingPacket{})
+// 在一次写入中发送多个包，交给连接的写入者按优先级和顺序写入，ctx结束时返回
+func (c *Client) sendPacketsPriority(ctx context.Context, priority Priority, packets ...lmproto.Frame) error {
+	data := make([][]byte, len(packets))
+	total := 0
+	for i, packet := range packets {
+		packetData, err := c.proto.EncodePacket(packet, c.opts.ProtoVersion)
+		if err != nil {
+			return err
+		}
+		data[i] = packetData
+		total += len(packetData)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	writer := c.getWriter()
+	if writer == nil {
+		return ErrNotConnected
+	}
+	if err := writer.write(ctx, priority, data); err != nil {
+		for _, packet := range packets {
+			c.logger.Warn("发送包失败！", "type", packet.GetPacketType(), "error", err)
+		}
+		return err
+	}
+	for i, packet := range packets {
+		c.logger.Debug("发送包", "type", packet.GetPacketType(), "bytes", len(data[i]))
+		c.stats.addSent(packet.GetPacketType(), len(data[i]))
+	}
+	c.sendTotalMsgBytes.Add(int64(total))
+	return nil
 }
 
-// 发送包
-func (c *Client) sendPacket(packet lmproto.Frame) error {
-	data, err := c.proto.EncodePacket(packet, c.opts.ProtoVersion)
-	if err != nil {
-		return err
+// bindContext 将ctx的截止时间和取消绑定到连接的deadline上，返回的函数用于解除绑定并返回ctx的错误
+func bindContext(ctx context.Context, setDeadline func(time.Time) error) func() error {
+	deadline, hasDeadline := ctx.Deadline()
+	if hasDeadline {
+		setDeadline(deadline)
+	}
+	if ctx.Done() == nil {
+		return func() error {
+			return nil
+		}
+	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			setDeadline(time.Unix(1, 0)) // 设置一个已过去的时间，让阻塞中的读写立即返回
+		case <-stop:
+		}
+	}()
+	return func() error {
+		close(stop)
+		<-stopped
+		setDeadline(time.Time{})
+		if hasDeadline && ctx.Err() == nil && !time.Now().Before(deadline) {
+			return context.DeadlineExceeded // 连接的deadline可能比ctx先到期
+		}
+		return ctx.Err()
 	}
-	c.sendTotalMsgBytes.Add(int64(len(data)))
-	_, err = c.conn.Write(data)
-	return err
 }
 
-func (c *Client) loopConn() {
+func (c *Client) loopConn(conn Conn, writer *connWriter, stopHeartbeatChan chan struct{}) {
+	var err error
+	var frame lmproto.Frame
 	for {
-		frame, err := c.proto.DecodePacketWithConn(c.conn, c.opts.ProtoVersion)
+		frame, err = c.readPacket(conn)
 		if err != nil {
-			log.Println("解码数据失败！", err)
-			c.handleClose()
+			c.logger.Warn("解码数据失败！", "error", err)
+			c.handleClose(conn)
+			goto exit
+		}
+		if err = c.handlePacket(frame); err != nil {
+			c.handleClose(conn)
 			goto exit
 		}
-		c.handlePacket(frame)
 	}
 exit:
-	log.Println("断开，开始重连...")
-	c.connected.Store(true)
-	c.stopHeartbeatChan <- true
-	c.Connect()
+	writer.close()
+	close(stopHeartbeatChan)
+	if c.opts.ReconnectPolicy == nil {
+		c.setState(StateIdle, err)
+		return
+	}
+	if c.setState(StateReconnecting, err) == nil {
+		c.reconnect(err)
+	}
 }
 
-func (c *Client) handlePacket(frame lmproto.Frame) {
+// 按重连策略重连，直到重连成功、放弃重连或客户端被关闭
+func (c *Client) reconnect(cause error) {
+	policy := c.opts.ReconnectPolicy
+	c.logger.Info("断开，开始重连...", "cause", cause)
+	for attempt := 1; ; attempt++ {
+		if policy.MaxAttempts > 0 && attempt > policy.MaxAttempts {
+			c.logger.Error("重连次数超过限制，放弃重连！", "attempts", policy.MaxAttempts, "error", cause)
+			c.close(cause)
+			if policy.OnGiveUp != nil {
+				policy.OnGiveUp(cause)
+			}
+			return
+		}
+		select {
+		case <-time.After(policy.Delay(attempt)):
+		case <-c.closeChan:
+			return
+		}
+		c.stats.reconnectAttempts.Inc()
+		if cause = c.connect(context.Background(), StateReconnecting); cause == nil {
+			c.stats.reconnects.Inc()
+			return
+		}
+		if cause == ErrClosed {
+			return
+		}
+		if _, ok := cause.(*StateTransitionError); ok { // 重连期间用户调用了Connect，由它负责连接
+			c.logger.Info("已经在连接，停止重连", "state", c.State())
+			return
+		}
+		c.logger.Warn("重连失败！", "attempt", attempt, "error", cause)
+	}
+}
+
+// 从连接读取一个包
+func (c *Client) readPacket(conn Conn) (lmproto.Frame, error) {
+	r := &countingReader{r: conn}
+	frame, err := c.proto.DecodePacketWithConn(r, c.opts.ProtoVersion)
+	if err != nil {
+		return nil, err
+	}
+	c.logger.Debug("收到包", "type", frame.GetPacketType(), "bytes", r.n)
+	c.stats.addReceived(frame.GetPacketType(), r.n)
+	return frame, nil
+}
+
+// 处理包，返回错误时断开连接
+func (c *Client) handlePacket(frame lmproto.Frame) error {
 	switch frame.GetPacketType() {
 	case lmproto.SENDACK: // 发送回执
 		c.handleSendackPacket(frame.(*lmproto.SendackPacket))
@@ -212,48 +648,111 @@ func (c *Client) handlePacket(frame lmproto.Frame) {
 	case lmproto.RECV: // 收到消息
 		c.handleRecvPacket(frame.(*lmproto.RecvPacket))
 		break
+	case lmproto.PONG: // 心跳回应
+		c.handlePong()
+		break
+	case lmproto.DISCONNECT: // 服务端断开(被踢)
+		return c.handleDisconnectPacket(frame.(*lmproto.DisconnectPacket))
+	}
+	return nil
+}
+
+// 处理服务端的断开包，一般是同账号同设备标示的其他设备登录后被踢下线
+func (c *Client) handleDisconnectPacket(packet *lmproto.DisconnectPacket) error {
+	err := &KickedError{
+		ReasonCode: packet.ReasonCode,
+		Reason:     packet.Reason,
 	}
+	c.logger.Warn("被服务端断开！", "reasonCode", packet.ReasonCode, "reason", packet.Reason)
+	if c.onKicked != nil {
+		c.onKicked(packet.ReasonCode, packet.Reason)
+	}
+	if policy := c.opts.ReconnectPolicy; policy == nil || !policy.ReconnectOnKick {
+		c.close(err) // 不再重连，避免和其他设备互踢
+	}
+	return err
 }
 
 func (c *Client) handleSendackPacket(packet *lmproto.SendackPacket) {
 	if c.onSendack != nil {
 		c.onSendack(packet)
 	}
-	for i, sendPacket := range c.sending {
-		if sendPacket.ClientSeq == packet.ClientSeq {
-			c.sending = append(c.sending[:i], c.sending[i+1:]...)
-			break
-		}
+	c.stopRetransmit(packet.ClientSeq)
+	latency := time.Duration(-1)
+	if sentAt, ok := c.stats.takeSentAt(packet.ClientSeq); ok {
+		latency = time.Since(sentAt)
+	}
+	c.stats.addSendack(packet.ReasonCode, latency)
+	c.removeSending(packet.ClientSeq)
+	c.resolveSendack(packet)
+	c.acks.push(packet)
+}
+
+// 从发送中的包里移除
+func (c *Client) removeSending(clientSeq uint64) {
+	c.stats.takeSentAt(clientSeq)
+	if err := c.outbox.Remove(clientSeq); err != nil {
+		c.logger.Error("从发件箱移除消息失败！", "clientSeq", clientSeq, "error", err)
+	}
+	select {
+	case c.sendingDrainChan <- struct{}{}:
+	default:
 	}
 }
 
 // 处理接受包
 func (c *Client) handleRecvPacket(packet *lmproto.RecvPacket) {
-	var err error
-	if c.onRecv != nil {
-		err = c.onRecv(packet)
+	deduper := c.opts.Deduper
+	if deduper != nil && deduper.Has(packet) {
+		c.logger.Debug("收到重复的消息", "messageID", packet.MessageID, "clientMsgNo", packet.ClientMsgNo)
+		c.stats.duplicates.Inc()
+		c.sendRecvack(packet)
+		return
 	}
-	if err == nil {
-		c.sendPacket(&lmproto.RecvackPacket{
-			MessageID:  packet.MessageID,
-			MessageSeq: packet.MessageSeq,
-		})
+	if c.sequencer != nil {
+		c.sequencer.push(packet)
+		return
 	}
+	c.deliverRecv(packet)
 }
 
-func parseAddr(addr string) (network, address string, port int) {
-	network = "tcp"
-	address = strings.ToLower(addr)
-	if strings.Contains(address, "://") {
-		pair := strings.Split(address, "://")
-		network = pair[0]
-		address = pair[1]
-		pair2 := strings.Split(address, ":")
-		portStr := pair2[1]
-		portInt64, _ := strconv.ParseInt(portStr, 10, 64)
-		port = int(portInt64)
+// 投递收到的消息，开启了并发处理时放入处理队列后即返回
+func (c *Client) deliverRecv(packet *lmproto.RecvPacket) error {
+	if c.workers != nil {
+		c.workers.submit(packet)
+		return nil
+	}
+	return c.processRecv(packet)
+}
+
+// 把收到的消息交给拦截器和应用，成功后回执
+func (c *Client) processRecv(packet *lmproto.RecvPacket) error {
+	handler := chainRecvInterceptors(c.opts.RecvInterceptors, func(ctx context.Context, packet *lmproto.RecvPacket) error {
+		return c.dispatchRecv(packet)
+	})
+	if err := handler(context.Background(), packet); err != nil {
+		return err
+	}
+	if deduper := c.opts.Deduper; deduper != nil {
+		if err := deduper.Add(packet); err != nil {
+			c.logger.Error("消息加入去重窗口失败！", "messageID", packet.MessageID, "error", err)
+		}
+	}
+	c.sendRecvack(packet)
+	return nil
+}
+
+// 回执收到的消息，开启了批量回执时先攒起来
+func (c *Client) sendRecvack(packet *lmproto.RecvPacket) {
+	recvack := &lmproto.RecvackPacket{
+		MessageID:  packet.MessageID,
+		MessageSeq: packet.MessageSeq,
+	}
+	if c.recvacks != nil {
+		c.recvacks.add(recvack)
+		return
 	}
-	return
+	c.sendPacket(recvack)
 }
 
 // Channel Channel
@@ -1,8 +1,14 @@
 package client
 
 import (
+	"context"
+	"errors"
+	"net"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -11,3 +17,231 @@ func TestSendMessage(t *testing.T) {
 	err := c.Connect()
 	assert.NoError(t, err)
 }
+
+func TestConnectContextHandshakeTimeout(t *testing.T) {
+	// 服务端不回连接回执
+	s := newTestServer(t, func(s *testServer, conn net.Conn, frame lmproto.Frame) {})
+	c := New(s.addr(), WithUID("1"), WithToken("1234"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	start := time.Now()
+	err := c.ConnectContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestSendMessageContext(t *testing.T) {
+	s := newTestServer(t, nil)
+	c := New(s.addr(), WithUID("1"), WithToken("1234"))
+	err := c.ConnectContext(context.Background())
+	assert.NoError(t, err)
+	defer c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+
+	err = c.SendMessageContext(context.Background(), NewChannel("test", 1), []byte("hello"))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = c.SendMessageContext(ctx, NewChannel("test", 1), []byte("hello"))
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestReconnect(t *testing.T) {
+	s := newTestServer(t, nil)
+	c := New(s.addr(), WithUID("1"), WithToken("1234"), WithReconnectPolicy(&ReconnectPolicy{
+		InitialDelay: time.Millisecond * 10,
+		Multiplier:   2,
+		MaxDelay:     time.Millisecond * 100,
+	}))
+	err := c.Connect()
+	assert.NoError(t, err)
+	defer c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+
+	conn := <-s.conns
+	conn.Close()
+	select {
+	case <-s.conns:
+	case <-time.After(time.Second):
+		t.Fatal("没有重连")
+	}
+}
+
+func TestReconnectGiveUp(t *testing.T) {
+	s := newTestServer(t, nil)
+	giveUp := make(chan error, 1)
+	c := New(s.addr(), WithUID("1"), WithToken("1234"), WithReconnectPolicy(&ReconnectPolicy{
+		InitialDelay: time.Millisecond * 10,
+		Multiplier:   1,
+		MaxAttempts:  2,
+		OnGiveUp: func(err error) {
+			giveUp <- err
+		},
+	}))
+	err := c.Connect()
+	assert.NoError(t, err)
+	defer c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+
+	s.close()
+	(<-s.conns).Close()
+	select {
+	case err = <-giveUp:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("没有放弃重连")
+	}
+}
+
+func TestDisconnectDrain(t *testing.T) {
+	// 服务端延迟回执
+	s := newTestServer(t, func(s *testServer, conn net.Conn, frame lmproto.Frame) {
+		if frame.GetPacketType() == lmproto.SEND {
+			time.Sleep(time.Millisecond * 50)
+		}
+		defaultTestHandler(s, conn, frame)
+	})
+	c := New(s.addr(), WithUID("1"), WithToken("1234"))
+	err := c.Connect()
+	assert.NoError(t, err)
+
+	err = c.SendMessage(NewChannel("test", 1), []byte("hello"))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = c.Disconnect(ctx, lmproto.ReasonSuccess, "bye")
+	assert.NoError(t, err)
+	assert.Equal(t, StateClosed, c.State())
+	assert.Equal(t, ErrClosed, c.SendMessage(NewChannel("test", 1), []byte("hello")))
+
+	types := make([]lmproto.PacketType, 0)
+	for frame := range s.frames {
+		types = append(types, frame.GetPacketType())
+		if frame.GetPacketType() == lmproto.DISCONNECT {
+			assert.Equal(t, "bye", frame.(*lmproto.DisconnectPacket).Reason)
+			break
+		}
+	}
+	assert.Equal(t, []lmproto.PacketType{lmproto.CONNECT, lmproto.SEND, lmproto.DISCONNECT}, types)
+}
+
+func TestDisconnectTimeout(t *testing.T) {
+	// 服务端不回发送回执
+	s := newTestServer(t, func(s *testServer, conn net.Conn, frame lmproto.Frame) {
+		if frame.GetPacketType() != lmproto.SEND {
+			defaultTestHandler(s, conn, frame)
+		}
+	})
+	c := New(s.addr(), WithUID("1"), WithToken("1234"))
+	err := c.Connect()
+	assert.NoError(t, err)
+
+	err = c.SendMessage(NewChannel("test", 1), []byte("hello"))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	err = c.Disconnect(ctx, lmproto.ReasonSuccess, "bye")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, StateClosed, c.State())
+	for frame := range s.frames {
+		if frame.GetPacketType() == lmproto.DISCONNECT {
+			break
+		}
+	}
+}
+
+func TestKicked(t *testing.T) {
+	s := newTestServer(t, nil)
+	c := New(s.addr(), WithUID("1"), WithToken("1234"), WithReconnectPolicy(&ReconnectPolicy{
+		InitialDelay: time.Millisecond * 10,
+		Multiplier:   1,
+	}))
+	kicked := make(chan string, 1)
+	c.SetOnKicked(func(reasonCode lmproto.ReasonCode, reason string) {
+		kicked <- reason
+	})
+	err := c.Connect()
+	assert.NoError(t, err)
+
+	s.write(<-s.conns, &lmproto.DisconnectPacket{ReasonCode: lmproto.ReasonError, Reason: "其他设备登录"})
+	assert.Equal(t, "其他设备登录", <-kicked)
+	assert.Eventually(t, func() bool {
+		return c.State() == StateClosed
+	}, time.Second, time.Millisecond*10)
+	assert.True(t, errors.Is(c.Err(), ErrKicked))
+
+	// 被踢后不重连
+	select {
+	case <-s.conns:
+		t.Fatal("被踢后不应该重连")
+	case <-time.After(time.Millisecond * 100):
+	}
+}
+
+func TestNewOptionsPerClient(t *testing.T) {
+	c1 := New("tcp://127.0.0.1:6666", WithUID("1"), WithoutReconnect())
+	c2 := New("tcp://127.0.0.1:6666", WithUID("2"))
+	assert.Equal(t, "1", c1.UID())
+	assert.Equal(t, "2", c2.UID())
+	assert.Nil(t, c1.opts.ReconnectPolicy)
+	assert.NotNil(t, c2.opts.ReconnectPolicy)
+}
+
+func TestConnectWhileReconnecting(t *testing.T) {
+	s := newTestServer(t, nil)
+	gaveUp := make(chan error, 1)
+	c := New(s.addr(), WithUID("1"), WithToken("1234"), WithReconnectPolicy(&ReconnectPolicy{
+		InitialDelay: time.Millisecond * 50,
+		Multiplier:   1,
+		MaxDelay:     time.Millisecond * 50,
+		MaxAttempts:  2,
+		OnGiveUp: func(err error) {
+			gaveUp <- err
+		},
+	}))
+	err := c.Connect()
+	assert.NoError(t, err)
+	defer c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+
+	(<-s.conns).Close()
+	assert.Eventually(t, func() bool {
+		return c.State() == StateReconnecting
+	}, time.Second, time.Millisecond)
+	// 用户在重连期间连接成功，后台的重连停止，不会关闭客户端
+	err = c.Connect()
+	assert.NoError(t, err)
+	select {
+	case err := <-gaveUp:
+		t.Fatalf("unexpected give up: %v", err)
+	case <-time.After(time.Millisecond * 200):
+	}
+	assert.Equal(t, StateConnected, c.State())
+}
+
+func TestCloseErrRace(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		c := New("tcp://127.0.0.1:0")
+		kicked := &KickedError{ReasonCode: lmproto.ReasonAuthFail, Reason: "kicked"}
+		var (
+			wg      sync.WaitGroup
+			kickWon bool
+		)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			kickWon = c.close(kicked)
+		}()
+		go func() {
+			defer wg.Done()
+			c.close(nil)
+		}()
+		wg.Wait()
+		// 关闭的原因总是切换到关闭状态的那次调用的
+		if kickWon {
+			assert.Equal(t, kicked, c.Err())
+		} else {
+			assert.Nil(t, c.Err())
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package client
+
+import "time"
+
+// TimeDiff 客户端时间与服务器时间的差值(客户端时间-服务器时间)，连接成功后由连接回执提供
+func (c *Client) TimeDiff() time.Duration {
+	return time.Duration(c.timeDiff.Load()) * time.Millisecond
+}
+
+// ServerNow 当前的服务器时间
+func (c *Client) ServerNow() time.Time {
+	return c.ToServerTime(time.Now())
+}
+
+// ToServerTime 将客户端时间转换为服务器时间
+func (c *Client) ToServerTime(t time.Time) time.Time {
+	return t.Add(-c.TimeDiff())
+}
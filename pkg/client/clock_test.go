@@ -0,0 +1,39 @@
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerTime(t *testing.T) {
+	serverTime := time.Now().Add(-time.Minute) // 服务器时间比客户端慢一分钟
+	clientTimestamps := make(chan int64, 1)
+	s := newTestServer(t, func(s *testServer, conn net.Conn, frame lmproto.Frame) {
+		if packet, ok := frame.(*lmproto.ConnectPacket); ok {
+			clientTimestamps <- packet.ClientTimestamp
+			s.write(conn, &lmproto.ConnackPacket{
+				TimeDiff:   packet.ClientTimestamp - serverTime.UnixNano()/int64(time.Millisecond),
+				ReasonCode: lmproto.ReasonSuccess,
+			})
+			return
+		}
+		defaultTestHandler(s, conn, frame)
+	})
+	c := New(s.addr(), WithUID("1"), WithToken("1234"))
+	assert.NoError(t, c.Connect())
+	defer c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+
+	// 客户端时间戳单位为毫秒
+	clientTimestamp := <-clientTimestamps
+	assert.InDelta(t, time.Now().UnixNano()/int64(time.Millisecond), clientTimestamp, 1000)
+
+	assert.InDelta(t, float64(time.Minute), float64(c.TimeDiff()), float64(time.Second))
+	assert.WithinDuration(t, time.Now().Add(-time.Minute), c.ServerNow(), time.Second)
+	clientTime := time.Date(2020, 7, 10, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, clientTime.Add(-c.TimeDiff()), c.ToServerTime(clientTime))
+}
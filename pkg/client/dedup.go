@@ -0,0 +1,247 @@
+package client
+
+import (
+	"container/list"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+	"github.com/pkg/errors"
+)
+
+// Deduper 收到消息的去重窗口，重连后服务端可能重新投递已经处理过的消息
+// 消息处理成功后才加入窗口，窗口内已有相同MessageID或ClientMsgNo的消息会直接回执，不再交给应用
+type Deduper interface {
+	// Has 窗口内是否已有相同的消息
+	Has(packet *lmproto.RecvPacket) bool
+	// Add 把处理成功的消息加入窗口
+	Add(packet *lmproto.RecvPacket) error
+	// Close 关闭去重窗口
+	Close() error
+}
+
+// 窗口里的一条消息
+type dedupEntry struct {
+	messageID   int64
+	clientMsgNo string
+	seenAt      time.Time
+}
+
+// 只按ttl淘汰时，日志记录数至少达到这个数才压缩
+const minDedupCompactRecords = 64
+
+// 按收到顺序保存的去重窗口，超过size条或者早于ttl的消息被淘汰，size不大于0时只按ttl淘汰
+type dedupWindow struct {
+	size    int
+	ttl     time.Duration
+	entries *list.List // 按收到顺序保存的*dedupEntry
+	byID    map[int64]*list.Element
+	byNo    map[string]*list.Element
+}
+
+func newDedupWindow(size int, ttl time.Duration) *dedupWindow {
+	return &dedupWindow{
+		size:    size,
+		ttl:     ttl,
+		entries: list.New(),
+		byID:    make(map[int64]*list.Element),
+		byNo:    make(map[string]*list.Element),
+	}
+}
+
+func (w *dedupWindow) has(packet *lmproto.RecvPacket, now time.Time) bool {
+	w.expire(now)
+	if _, ok := w.byID[packet.MessageID]; ok && packet.MessageID != 0 {
+		return true
+	}
+	if _, ok := w.byNo[packet.ClientMsgNo]; ok && packet.ClientMsgNo != "" {
+		return true
+	}
+	return false
+}
+
+func (w *dedupWindow) add(entry *dedupEntry, now time.Time) {
+	element := w.entries.PushBack(entry)
+	if entry.messageID != 0 {
+		w.byID[entry.messageID] = element
+	}
+	if entry.clientMsgNo != "" {
+		w.byNo[entry.clientMsgNo] = element
+	}
+	w.expire(now)
+}
+
+// 淘汰超出数量和过期的消息
+func (w *dedupWindow) expire(now time.Time) {
+	for front := w.entries.Front(); front != nil; front = w.entries.Front() {
+		entry := front.Value.(*dedupEntry)
+		if (w.size <= 0 || w.entries.Len() <= w.size) && (w.ttl <= 0 || now.Sub(entry.seenAt) < w.ttl) {
+			return
+		}
+		w.entries.Remove(front)
+		if w.byID[entry.messageID] == front {
+			delete(w.byID, entry.messageID)
+		}
+		if w.byNo[entry.clientMsgNo] == front {
+			delete(w.byNo, entry.clientMsgNo)
+		}
+	}
+}
+
+// MemoryDeduper 内存去重窗口，进程退出后丢失
+type MemoryDeduper struct {
+	window *dedupWindow
+	lock   sync.Mutex
+}
+
+// NewMemoryDeduper 创建内存去重窗口，size大于0时最多保存size条消息，ttl大于0时消息超过ttl后淘汰
+// size不大于0时只按ttl淘汰，两个都不大于0时不淘汰(窗口一直增长)
+func NewMemoryDeduper(size int, ttl time.Duration) *MemoryDeduper {
+	return &MemoryDeduper{
+		window: newDedupWindow(size, ttl),
+	}
+}
+
+// Has 窗口内是否已有相同的消息
+func (m *MemoryDeduper) Has(packet *lmproto.RecvPacket) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.window.has(packet, time.Now())
+}
+
+// Add 把消息加入窗口
+func (m *MemoryDeduper) Add(packet *lmproto.RecvPacket) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	m.window.add(&dedupEntry{messageID: packet.MessageID, clientMsgNo: packet.ClientMsgNo, seenAt: now}, now)
+	return nil
+}
+
+// Close 关闭去重窗口
+func (m *MemoryDeduper) Close() error {
+	return nil
+}
+
+// FileDeduper 文件去重窗口，加入的消息以只追加的日志保存到文件，进程重启后可以恢复
+// 每条记录包含收到时间、MessageID和ClientMsgNo，日志记录数超过窗口大小的两倍时压缩
+type FileDeduper struct {
+	path    string
+	file    *os.File
+	window  *dedupWindow
+	records int // 日志中的记录数
+	lock    sync.Mutex
+}
+
+// NewFileDeduper 创建文件去重窗口，文件已存在时加载其中的消息
+// size不大于0时只按ttl淘汰，size和ttl不能都不大于0
+func NewFileDeduper(path string, size int, ttl time.Duration) (*FileDeduper, error) {
+	if size <= 0 && ttl <= 0 {
+		return nil, errors.New("去重窗口大小和ttl不能都不大于0！")
+	}
+	f := &FileDeduper{
+		path:   path,
+		window: newDedupWindow(size, ttl),
+	}
+	now := time.Now()
+	err := readRecords(path, func(record []byte) error {
+		entry, err := decodeDedupEntry(record)
+		if err != nil {
+			return errors.Wrap(err, "解析去重日志失败！")
+		}
+		f.window.add(entry, now)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = f.compact(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Has 窗口内是否已有相同的消息
+func (f *FileDeduper) Has(packet *lmproto.RecvPacket) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.window.has(packet, time.Now())
+}
+
+// Add 把消息加入窗口并写入日志(不等待写入磁盘，进程崩溃时最后几条消息可能会重复投递)
+func (f *FileDeduper) Add(packet *lmproto.RecvPacket) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	now := time.Now()
+	entry := &dedupEntry{messageID: packet.MessageID, clientMsgNo: packet.ClientMsgNo, seenAt: now}
+	f.window.add(entry, now)
+	if err := appendRecord(f.file, encodeDedupEntry(entry), false); err != nil {
+		return err
+	}
+	f.records++
+	if f.records > f.compactThreshold() {
+		return f.compact()
+	}
+	return nil
+}
+
+// 日志压缩的阈值，按条数淘汰时为窗口大小的两倍，只按ttl淘汰时为窗口内消息数的两倍
+func (f *FileDeduper) compactThreshold() int {
+	if f.window.size > 0 {
+		return f.window.size * 2
+	}
+	if n := f.window.entries.Len() * 2; n > minDedupCompactRecords {
+		return n
+	}
+	return minDedupCompactRecords
+}
+
+// Close 关闭去重窗口
+func (f *FileDeduper) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.file.Close()
+}
+
+// 只保留窗口内的消息重写日志
+func (f *FileDeduper) compact() error {
+	records := make([][]byte, 0, f.window.entries.Len())
+	for element := f.window.entries.Front(); element != nil; element = element.Next() {
+		records = append(records, encodeDedupEntry(element.Value.(*dedupEntry)))
+	}
+	file, err := rewriteJournal(f.path, records)
+	if err != nil {
+		return err
+	}
+	if f.file != nil {
+		f.file.Close()
+	}
+	f.file = file
+	f.records = len(records)
+	return nil
+}
+
+func encodeDedupEntry(entry *dedupEntry) []byte {
+	enc := lmproto.NewEncoder()
+	enc.WriteInt64(entry.seenAt.UnixNano())
+	enc.WriteInt64(entry.messageID)
+	enc.WriteString(entry.clientMsgNo)
+	return enc.Bytes()
+}
+
+func decodeDedupEntry(record []byte) (*dedupEntry, error) {
+	dec := lmproto.NewDecoder(record)
+	seenAt, err := dec.Int64()
+	if err != nil {
+		return nil, err
+	}
+	entry := &dedupEntry{seenAt: time.Unix(0, seenAt)}
+	if entry.messageID, err = dec.Int64(); err != nil {
+		return nil, err
+	}
+	if entry.clientMsgNo, err = dec.String(); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupWindow(t *testing.T) {
+	window := newDedupWindow(2, time.Minute)
+	now := time.Now()
+	window.add(&dedupEntry{messageID: 1, clientMsgNo: "a", seenAt: now}, now)
+	window.add(&dedupEntry{messageID: 2, clientMsgNo: "b", seenAt: now}, now)
+	assert.True(t, window.has(&lmproto.RecvPacket{MessageID: 1}, now))
+	assert.True(t, window.has(&lmproto.RecvPacket{MessageID: 100, ClientMsgNo: "b"}, now))
+	assert.False(t, window.has(&lmproto.RecvPacket{MessageID: 3, ClientMsgNo: "c"}, now))
+	assert.False(t, window.has(&lmproto.RecvPacket{}, now))
+
+	// 超过窗口大小淘汰最早的
+	window.add(&dedupEntry{messageID: 3, clientMsgNo: "c", seenAt: now}, now)
+	assert.False(t, window.has(&lmproto.RecvPacket{MessageID: 1}, now))
+	assert.False(t, window.has(&lmproto.RecvPacket{ClientMsgNo: "a"}, now))
+	assert.True(t, window.has(&lmproto.RecvPacket{MessageID: 2}, now))
+
+	// 过期淘汰
+	assert.False(t, window.has(&lmproto.RecvPacket{MessageID: 3}, now.Add(time.Minute)))
+	assert.Equal(t, 0, window.entries.Len())
+}
+
+func TestFileDeduper(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedup")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dedup")
+
+	deduper, err := NewFileDeduper(path, 3, 0)
+	assert.NoError(t, err)
+	for i := int64(1); i <= 10; i++ { // 超过窗口大小两倍时压缩
+		assert.NoError(t, deduper.Add(&lmproto.RecvPacket{MessageID: i, ClientMsgNo: "msgno"}))
+	}
+	assert.NoError(t, deduper.Close())
+
+	deduper, err = NewFileDeduper(path, 3, 0)
+	assert.NoError(t, err)
+	defer deduper.Close()
+	assert.Equal(t, 3, deduper.window.entries.Len())
+	assert.False(t, deduper.Has(&lmproto.RecvPacket{MessageID: 7}))
+	assert.True(t, deduper.Has(&lmproto.RecvPacket{MessageID: 8}))
+	assert.True(t, deduper.Has(&lmproto.RecvPacket{MessageID: 10}))
+	assert.True(t, deduper.Has(&lmproto.RecvPacket{ClientMsgNo: "msgno"}))
+}
+
+func TestRecvDedup(t *testing.T) {
+	s := newTestServer(t, nil)
+	c := New(s.addr(), WithUID("1"), WithToken("1234"), WithDeduper(NewMemoryDeduper(100, time.Minute)))
+	recvChan := make(chan int64, 4)
+	c.SetOnRecv(func(packet *lmproto.RecvPacket) error {
+		recvChan <- packet.MessageID
+		return nil
+	})
+	err := c.Connect()
+	assert.NoError(t, err)
+	defer c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+	<-s.frames // CONNECT
+	conn := <-s.conns
+
+	s.write(conn, &lmproto.RecvPacket{MessageID: 1, MessageSeq: 1, ChannelID: "test", ChannelType: 1})
+	s.write(conn, &lmproto.RecvPacket{Framer: lmproto.Framer{DUP: true}, MessageID: 1, MessageSeq: 1, ChannelID: "test", ChannelType: 1})
+	s.write(conn, &lmproto.RecvPacket{MessageID: 2, MessageSeq: 2, ChannelID: "test", ChannelType: 1})
+
+	// 重复的消息也回执，但不交给应用
+	for _, messageID := range []int64{1, 1, 2} {
+		frame := <-s.frames
+		assert.Equal(t, messageID, frame.(*lmproto.RecvackPacket).MessageID)
+	}
+	assert.Equal(t, int64(1), <-recvChan)
+	assert.Equal(t, int64(2), <-recvChan)
+	assert.Equal(t, int64(1), c.Stats().Duplicates)
+}
+
+func TestFileDeduperTTLOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedup")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dedup")
+
+	_, err = NewFileDeduper(path, 0, 0)
+	assert.Error(t, err)
+
+	// 窗口大小为0时只按ttl淘汰，不会每次加入都压缩
+	deduper, err := NewFileDeduper(path, 0, time.Minute)
+	assert.NoError(t, err)
+	defer deduper.Close()
+	for i := int64(1); i <= 10; i++ {
+		assert.NoError(t, deduper.Add(&lmproto.RecvPacket{MessageID: i}))
+	}
+	assert.True(t, deduper.Has(&lmproto.RecvPacket{MessageID: 1}))
+	assert.Equal(t, 10, deduper.records)
+}
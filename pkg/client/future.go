@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+)
+
+// SendackError 发送回执的原因码不是成功
+type SendackError struct {
+	Sendack *lmproto.SendackPacket
+}
+
+func (e *SendackError) Error() string {
+	return fmt.Sprintf("消息发送失败！[%s]", e.Sendack.ReasonCode)
+}
+
+// 发送回执的等待结果
+type sendackResult struct {
+	sendack *lmproto.SendackPacket
+	err     error
+}
+
+// SendMessageWait 发送消息并等待发送回执
+// 回执的原因码不是成功时返回回执和*SendackError，重发次数用完时返回ErrAckTimeout
+// ctx结束时停止等待，但消息仍会继续重发
+func (c *Client) SendMessageWait(ctx context.Context, channel *Channel, payload []byte, opts ...SendOption) (*lmproto.SendackPacket, error) {
+	sendOpts, err := c.buildSendOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	packet := c.newSendPacket(channel, payload)
+	waiter := c.addSendackWaiter(packet.ClientSeq)
+	if err := c.sendMessage(ctx, packet, sendOpts); err != nil {
+		c.removeSendackWaiter(packet.ClientSeq)
+		return nil, err
+	}
+	select {
+	case result, ok := <-waiter:
+		if !ok {
+			return nil, ErrClosed
+		}
+		if result.err != nil {
+			return nil, result.err
+		}
+		if result.sendack.ReasonCode != lmproto.ReasonSuccess {
+			return result.sendack, &SendackError{Sendack: result.sendack}
+		}
+		return result.sendack, nil
+	case <-ctx.Done():
+		c.removeSendackWaiter(packet.ClientSeq)
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Client) addSendackWaiter(clientSeq uint64) chan sendackResult {
+	waiter := make(chan sendackResult, 1)
+	c.sendackWaitersLock.Lock()
+	c.sendackWaiters[clientSeq] = waiter
+	c.sendackWaitersLock.Unlock()
+	return waiter
+}
+
+func (c *Client) removeSendackWaiter(clientSeq uint64) chan sendackResult {
+	c.sendackWaitersLock.Lock()
+	defer c.sendackWaitersLock.Unlock()
+	waiter := c.sendackWaiters[clientSeq]
+	delete(c.sendackWaiters, clientSeq)
+	return waiter
+}
+
+// 将回执交给等待中的调用者
+func (c *Client) resolveSendack(sendack *lmproto.SendackPacket) {
+	if waiter := c.removeSendackWaiter(sendack.ClientSeq); waiter != nil {
+		waiter <- sendackResult{sendack: sendack}
+	}
+}
+
+// 通知等待中的调用者发送失败
+func (c *Client) rejectSendack(clientSeq uint64, err error) {
+	if waiter := c.removeSendackWaiter(clientSeq); waiter != nil {
+		waiter <- sendackResult{err: err}
+	}
+}
+
+// 客户端关闭时，让等待中的调用者返回ErrClosed
+func (c *Client) cancelSendackWaiters() {
+	c.sendackWaitersLock.Lock()
+	defer c.sendackWaitersLock.Unlock()
+	for clientSeq, waiter := range c.sendackWaiters {
+		close(waiter)
+		delete(c.sendackWaiters, clientSeq)
+	}
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendMessageWait(t *testing.T) {
+	s := newTestServer(t, func(s *testServer, conn net.Conn, frame lmproto.Frame) {
+		if packet, ok := frame.(*lmproto.SendPacket); ok && packet.ChannelID == "blacklist" {
+			s.write(conn, &lmproto.SendackPacket{
+				ClientSeq:  packet.ClientSeq,
+				ReasonCode: lmproto.ReasonInBlacklist,
+			})
+			return
+		}
+		if frame.GetPacketType() == lmproto.SEND && string(frame.(*lmproto.SendPacket).Payload) == "noack" {
+			return
+		}
+		defaultTestHandler(s, conn, frame)
+	})
+	c := New(s.addr(), WithUID("1"), WithToken("1234"))
+	err := c.Connect()
+	assert.NoError(t, err)
+
+	sendack, err := c.SendMessageWait(context.Background(), NewChannel("test", 1), []byte("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, lmproto.ReasonSuccess, sendack.ReasonCode)
+	assert.NotZero(t, sendack.ClientSeq)
+
+	sendack, err = c.SendMessageWait(context.Background(), NewChannel("blacklist", 1), []byte("hello"))
+	assert.Equal(t, &SendackError{Sendack: sendack}, err)
+	assert.Equal(t, lmproto.ReasonInBlacklist, sendack.ReasonCode)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	_, err = c.SendMessageWait(ctx, NewChannel("test", 1), []byte("noack"))
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// 客户端关闭时等待中的调用者返回ErrClosed
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		c.Disconnect(ctx, lmproto.ReasonSuccess, "")
+	}()
+	_, err = c.SendMessageWait(context.Background(), NewChannel("test", 1), []byte("noack"))
+	assert.Equal(t, ErrClosed, err)
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+)
+
+// RTTStats ping/pong往返时间统计
+type RTTStats struct {
+	Last     time.Duration // 最近一次
+	Smoothed time.Duration // 平滑值(同TCP的SRTT，新值权重1/8)
+	Min      time.Duration // 最小值
+	Max      time.Duration // 最大值
+	Count    int64         // 测量次数
+}
+
+// 加入一次测量结果
+func (r *RTTStats) add(rtt time.Duration) {
+	r.Last = rtt
+	if r.Count == 0 {
+		r.Smoothed = rtt
+		r.Min = rtt
+		r.Max = rtt
+	} else {
+		r.Smoothed += (rtt - r.Smoothed) / 8
+		if rtt < r.Min {
+			r.Min = rtt
+		}
+		if rtt > r.Max {
+			r.Max = rtt
+		}
+	}
+	r.Count++
+}
+
+// RTT 获取ping/pong往返时间统计
+func (c *Client) RTT() RTTStats {
+	c.rttLock.Lock()
+	defer c.rttLock.Unlock()
+	return c.rtt
+}
+
+// 心跳，每个连接一个，连接断开后退出
+func (c *Client) loopPing(conn Conn, stopHeartbeatChan chan struct{}) {
+	select { // 丢弃上个连接的pong
+	case <-c.pongChan:
+	default:
+	}
+	ticker := time.NewTicker(c.opts.HeartbeatInterval)
+	defer ticker.Stop()
+	var (
+		pingTime       time.Time
+		pongTimeout    <-chan time.Time // 等待pong超时，没有等待时为nil
+		retryPingCount int              // 连续没收到pong的次数
+	)
+	for {
+		select {
+		case <-ticker.C:
+			if pongTimeout != nil { // 还在等待上一个pong
+				break
+			}
+			pingTime = time.Now()
+			if err := c.ping(); err != nil {
+				c.logger.Warn("发送ping失败！", "error", err)
+			}
+			pongTimeout = time.After(c.opts.HeartbeatTimeout)
+		case pongTime := <-c.pongChan:
+			if pongTimeout == nil { // 不是对ping的回应
+				break
+			}
+			pongTimeout = nil
+			retryPingCount = 0
+			c.rttLock.Lock()
+			c.rtt.add(pongTime.Sub(pingTime))
+			c.rttLock.Unlock()
+		case <-pongTimeout:
+			pongTimeout = nil
+			retryPingCount++
+			if retryPingCount >= c.opts.HeartbeatMaxFails {
+				c.logger.Warn("连续没有收到pong，断开连接！", "fails", retryPingCount)
+				conn.Close() // 断开连接，让其重连
+				return
+			}
+		case <-stopHeartbeatChan:
+			return
+		}
+	}
+}
+
+// 发送ping，攒着的消息回执一起发送
+func (c *Client) ping() error {
+	return c.sendPacketsContext(context.Background(), append(c.takeRecvacks(), &lmproto.PingPacket{})...)
+}
+
+// 收到pong，交给心跳处理
+func (c *Client) handlePong() {
+	select {
+	case c.pongChan <- time.Now():
+	default:
+	}
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRTTStats(t *testing.T) {
+	var rtt RTTStats
+	rtt.add(time.Millisecond * 80)
+	rtt.add(time.Millisecond * 160)
+	rtt.add(time.Millisecond * 40)
+	assert.Equal(t, time.Millisecond*40, rtt.Last)
+	assert.Equal(t, time.Millisecond*40, rtt.Min)
+	assert.Equal(t, time.Millisecond*160, rtt.Max)
+	assert.Equal(t, time.Microsecond*83750, rtt.Smoothed)
+	assert.Equal(t, int64(3), rtt.Count)
+}
+
+func TestHeartbeat(t *testing.T) {
+	s := newTestServer(t, nil)
+	c := New(s.addr(), WithUID("1"), WithToken("1234"), WithHeartbeat(time.Millisecond*10, time.Millisecond*20, 2))
+	assert.NoError(t, c.Connect())
+	defer c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+
+	// 服务端回应pong，连接保持
+	assert.Eventually(t, func() bool {
+		return c.RTT().Count >= 5
+	}, time.Second, time.Millisecond*10)
+	assert.Equal(t, StateConnected, c.State())
+	rtt := c.RTT()
+	assert.True(t, rtt.Min > 0 && rtt.Min <= rtt.Max)
+}
+
+func TestHeartbeatTimeout(t *testing.T) {
+	// 服务端不回应pong
+	s := newTestServer(t, func(s *testServer, conn net.Conn, frame lmproto.Frame) {
+		if frame.GetPacketType() != lmproto.PING {
+			defaultTestHandler(s, conn, frame)
+		}
+	})
+	c := New(s.addr(), WithUID("1"), WithToken("1234"), WithHeartbeat(time.Millisecond*10, time.Millisecond*20, 2), WithoutReconnect())
+	assert.NoError(t, c.Connect())
+	assert.Eventually(t, func() bool {
+		return c.State() == StateIdle
+	}, time.Second, time.Millisecond*10)
+}
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+	"errors"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+)
+
+// ErrMessageDropped 消息被拦截器丢弃
+var ErrMessageDropped = errors.New("消息被拦截器丢弃！")
+
+// SendHandler 发送消息
+type SendHandler func(ctx context.Context, packet *lmproto.SendPacket) error
+
+// SendInterceptor 发送拦截器，调用next继续发送，可以修改packet(ClientSeq除外)或传给next一个新的包
+// 不调用next并返回nil表示丢弃消息，发送方会收到ErrMessageDropped；返回错误表示中止发送
+// 拦截器在消息加入发件箱之前执行，重发时不会再执行
+type SendInterceptor func(ctx context.Context, packet *lmproto.SendPacket, next SendHandler) error
+
+// RecvHandler 处理收到的消息
+type RecvHandler func(ctx context.Context, packet *lmproto.RecvPacket) error
+
+// RecvInterceptor 接收拦截器，调用next继续处理，可以修改packet或传给next一个新的包
+// 不调用next并返回nil表示丢弃消息(仍会回执)；返回错误表示处理失败，不会回执
+type RecvInterceptor func(ctx context.Context, packet *lmproto.RecvPacket, next RecvHandler) error
+
+// 把拦截器串成一个SendHandler，第一个拦截器最先执行
+func chainSendInterceptors(interceptors []SendInterceptor, handler SendHandler) SendHandler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, packet *lmproto.SendPacket) error {
+			return interceptor(ctx, packet, next)
+		}
+	}
+	return handler
+}
+
+// 把拦截器串成一个RecvHandler，第一个拦截器最先执行
+func chainRecvInterceptors(interceptors []RecvInterceptor, handler RecvHandler) RecvHandler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, packet *lmproto.RecvPacket) error {
+			return interceptor(ctx, packet, next)
+		}
+	}
+	return handler
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendInterceptors(t *testing.T) {
+	s := newTestServer(t, nil)
+	errForbidden := errors.New("forbidden")
+	var order []string
+	c := New(s.addr(), WithUID("1"), WithToken("1234"), WithSendInterceptors(
+		func(ctx context.Context, packet *lmproto.SendPacket, next SendHandler) error {
+			order = append(order, "first")
+			switch packet.ChannelID {
+			case "drop":
+				return nil
+			case "forbidden":
+				return errForbidden
+			}
+			return next(ctx, packet)
+		},
+		func(ctx context.Context, packet *lmproto.SendPacket, next SendHandler) error {
+			order = append(order, "second")
+			packet.Payload = bytes.ToUpper(packet.Payload)
+			return next(ctx, packet)
+		},
+	))
+	err := c.Connect()
+	assert.NoError(t, err)
+	defer c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+	<-s.frames // CONNECT
+
+	_, err = c.SendMessageWait(context.Background(), NewChannel("test", 1), []byte("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, order)
+	frame := <-s.frames
+	assert.Equal(t, []byte("HELLO"), frame.(*lmproto.SendPacket).Payload)
+
+	err = c.SendMessage(NewChannel("drop", 1), []byte("hello"))
+	assert.Equal(t, ErrMessageDropped, err)
+	err = c.SendMessage(NewChannel("forbidden", 1), []byte("hello"))
+	assert.Equal(t, errForbidden, err)
+	assert.Equal(t, 0, c.Stats().OutboxPending)
+	select {
+	case frame := <-s.frames:
+		t.Fatalf("unexpected frame %v", frame)
+	case <-time.After(time.Millisecond * 50):
+	}
+}
+
+func TestRecvInterceptors(t *testing.T) {
+	s := newTestServer(t, nil)
+	c := New(s.addr(), WithUID("1"), WithToken("1234"), WithRecvInterceptors(
+		func(ctx context.Context, packet *lmproto.RecvPacket, next RecvHandler) error {
+			if packet.ChannelID == "drop" {
+				return nil
+			}
+			packet.Payload = bytes.ToUpper(packet.Payload)
+			return next(ctx, packet)
+		},
+	))
+	recvChan := make(chan *lmproto.RecvPacket, 2)
+	c.SetOnRecv(func(packet *lmproto.RecvPacket) error {
+		recvChan <- packet
+		return nil
+	})
+	err := c.Connect()
+	assert.NoError(t, err)
+	defer c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+	<-s.frames // CONNECT
+	conn := <-s.conns
+
+	s.write(conn, &lmproto.RecvPacket{MessageID: 1, MessageSeq: 1, ChannelID: "drop", ChannelType: 1, Payload: []byte("hello")})
+	s.write(conn, &lmproto.RecvPacket{MessageID: 2, MessageSeq: 2, ChannelID: "test", ChannelType: 1, Payload: []byte("hello")})
+
+	packet := <-recvChan
+	assert.Equal(t, int64(2), packet.MessageID)
+	assert.Equal(t, []byte("HELLO"), packet.Payload)
+	// 丢弃的消息也要回执
+	for _, messageID := range []int64{1, 2} {
+		frame := <-s.frames
+		assert.Equal(t, messageID, frame.(*lmproto.RecvackPacket).MessageID)
+	}
+}
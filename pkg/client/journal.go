@@ -0,0 +1,79 @@
+package client
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+// 只追加的日志文件，每条记录为4字节的长度加记录内容
+
+// 追加一条记录，sync为true时等待写入磁盘
+func appendRecord(file *os.File, record []byte, sync bool) error {
+	data := make([]byte, 4+len(record))
+	binary.BigEndian.PutUint32(data, uint32(len(record)))
+	copy(data[4:], record)
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+	if sync {
+		return file.Sync()
+	}
+	return nil
+}
+
+// 依次读取日志中的记录，文件不存在时直接返回，最后一条记录不完整时(写入过程中进程退出)忽略它
+func readRecords(path string, fn func(record []byte) error) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+	lengthBytes := make([]byte, 4)
+	for {
+		if _, err = io.ReadFull(r, lengthBytes); err != nil {
+			break
+		}
+		record := make([]byte, binary.BigEndian.Uint32(lengthBytes))
+		if _, err = io.ReadFull(r, record); err != nil {
+			break
+		}
+		if err = fn(record); err != nil {
+			return err
+		}
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil
+	}
+	return err
+}
+
+// 用records重写日志(先写临时文件再替换)，返回以追加模式打开的新日志
+func rewriteJournal(path string, records [][]byte) (*os.File, error) {
+	tmpPath := path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if err = appendRecord(tmp, record, false); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	tmp.Close()
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+}
@@ -0,0 +1,206 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level 日志级别
+type Level int8
+
+const (
+	// LevelDebug 调试，包括每个收发的包
+	LevelDebug Level = iota
+	// LevelInfo 连接事件
+	LevelInfo
+	// LevelWarn 可恢复的错误
+	LevelWarn
+	// LevelError 错误
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("Level(%d)", int8(l))
+}
+
+// Logger 日志，keyvals为依次排列的字段名和字段值
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+// NopLogger 不输出任何日志
+type NopLogger struct{}
+
+// Debug Debug
+func (NopLogger) Debug(msg string, keyvals ...interface{}) {}
+
+// Info Info
+func (NopLogger) Info(msg string, keyvals ...interface{}) {}
+
+// Warn Warn
+func (NopLogger) Warn(msg string, keyvals ...interface{}) {}
+
+// Error Error
+func (NopLogger) Error(msg string, keyvals ...interface{}) {}
+
+// 日志输出函数
+type logFunc func(level Level, msg string, keyvals []interface{})
+
+// 按级别过滤日志并交给logFunc输出
+type leveledLogger struct {
+	level Level
+	log   logFunc
+}
+
+func (l *leveledLogger) Debug(msg string, keyvals ...interface{}) {
+	l.output(LevelDebug, msg, keyvals)
+}
+
+func (l *leveledLogger) Info(msg string, keyvals ...interface{}) {
+	l.output(LevelInfo, msg, keyvals)
+}
+
+func (l *leveledLogger) Warn(msg string, keyvals ...interface{}) {
+	l.output(LevelWarn, msg, keyvals)
+}
+
+func (l *leveledLogger) Error(msg string, keyvals ...interface{}) {
+	l.output(LevelError, msg, keyvals)
+}
+
+func (l *leveledLogger) output(level Level, msg string, keyvals []interface{}) {
+	if level >= l.level {
+		l.log(level, msg, keyvals)
+	}
+}
+
+// NewStdLogger 创建输出到标准库log.Logger的日志，格式为"[level] msg key=value ..."，logger为nil时使用log包的默认Logger
+func NewStdLogger(logger *log.Logger, level Level) Logger {
+	return &leveledLogger{
+		level: level,
+		log: func(level Level, msg string, keyvals []interface{}) {
+			var b strings.Builder
+			b.WriteString("[")
+			b.WriteString(level.String())
+			b.WriteString("] ")
+			b.WriteString(msg)
+			eachKeyval(keyvals, func(key string, value interface{}) {
+				fmt.Fprintf(&b, " %s=%v", key, value)
+			})
+			if logger == nil {
+				log.Println(b.String())
+			} else {
+				logger.Println(b.String())
+			}
+		},
+	}
+}
+
+// NewJSONLogger 创建每行输出一个JSON对象的日志，包含time、level、msg和所有字段
+func NewJSONLogger(w io.Writer, level Level) Logger {
+	var lock sync.Mutex
+	return &leveledLogger{
+		level: level,
+		log: func(level Level, msg string, keyvals []interface{}) {
+			var b strings.Builder
+			b.WriteString(`{"time":`)
+			writeJSONValue(&b, time.Now().Format(time.RFC3339Nano))
+			b.WriteString(`,"level":`)
+			writeJSONValue(&b, level.String())
+			b.WriteString(`,"msg":`)
+			writeJSONValue(&b, msg)
+			eachKeyval(keyvals, func(key string, value interface{}) {
+				b.WriteString(",")
+				writeJSONValue(&b, key)
+				b.WriteString(":")
+				writeJSONValue(&b, value)
+			})
+			b.WriteString("}\n")
+			lock.Lock()
+			io.WriteString(w, b.String())
+			lock.Unlock()
+		},
+	}
+}
+
+func writeJSONValue(b *strings.Builder, value interface{}) {
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case fmt.Stringer:
+		value = v.String()
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	b.Write(data)
+}
+
+// 依次遍历字段，字段数为奇数时最后一个字段的值为"(MISSING)"
+func eachKeyval(keyvals []interface{}, fn func(key string, value interface{})) {
+	for i := 0; i < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		var value interface{} = "(MISSING)"
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		fn(key, value)
+	}
+}
+
+// 为每条日志加上固定字段
+type fieldsLogger struct {
+	logger Logger
+	fields []interface{}
+}
+
+// withFields 返回每条日志都带上keyvals字段的日志，NopLogger原样返回，避免每条日志分配字段
+func withFields(logger Logger, keyvals ...interface{}) Logger {
+	switch logger.(type) {
+	case NopLogger, *NopLogger:
+		return logger
+	}
+	return &fieldsLogger{
+		logger: logger,
+		fields: keyvals,
+	}
+}
+
+func (f *fieldsLogger) Debug(msg string, keyvals ...interface{}) {
+	f.logger.Debug(msg, f.with(keyvals)...)
+}
+
+func (f *fieldsLogger) Info(msg string, keyvals ...interface{}) {
+	f.logger.Info(msg, f.with(keyvals)...)
+}
+
+func (f *fieldsLogger) Warn(msg string, keyvals ...interface{}) {
+	f.logger.Warn(msg, f.with(keyvals)...)
+}
+
+func (f *fieldsLogger) Error(msg string, keyvals ...interface{}) {
+	f.logger.Error(msg, f.with(keyvals)...)
+}
+
+func (f *fieldsLogger) with(keyvals []interface{}) []interface{} {
+	return append(append(make([]interface{}, 0, len(f.fields)+len(keyvals)), f.fields...), keyvals...)
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := withFields(NewJSONLogger(&buf, LevelInfo), "uid", "test")
+	logger.Debug("不输出")
+	logger.Warn("发送失败", "state", StateConnected, "error", errors.New("超时"), "count", 2)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 1)
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	expect := map[string]interface{}{
+		"level": "warn",
+		"msg":   "发送失败",
+		"uid":   "test",
+		"state": "Connected",
+		"error": "超时",
+		"count": float64(2),
+	}
+	for key, value := range expect {
+		assert.Equal(t, value, entry[key], key)
+	}
+	assert.Contains(t, entry, "time")
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStdLogger(log.New(&buf, "", 0), LevelDebug)
+	logger.Info("连接成功", "uid", "test", "odd")
+	assert.Equal(t, "[info] 连接成功 uid=test odd=(MISSING)\n", buf.String())
+}
+
+func TestWithFieldsNopLogger(t *testing.T) {
+	// 默认不输出日志时不加固定字段，避免每条日志分配
+	assert.Equal(t, NopLogger{}, withFields(NopLogger{}, "uid", "test"))
+	assert.Equal(t, NopLogger{}, New("tcp://127.0.0.1:0", WithUID("1")).logger)
+}
@@ -0,0 +1,175 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+)
+
+// ErrAccountExists 账号已存在
+var ErrAccountExists = errors.New("账号已存在！")
+
+// 默认同时连接的客户端数量
+const defaultConnectConcurrency = 32
+
+// Account 账号
+type Account struct {
+	UID   string // 用户uid
+	Token string // 连接IM的token
+}
+
+// BatchError 批量操作时部分账号失败，key为UID
+type BatchError map[string]error
+
+func (e BatchError) Error() string {
+	uids := make([]string, 0, len(e))
+	for uid := range e {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+	msgs := make([]string, 0, len(uids))
+	for _, uid := range uids {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", uid, e[uid]))
+	}
+	return fmt.Sprintf("%d个账号操作失败！[%s]", len(e), strings.Join(msgs, "; "))
+}
+
+// ClientManager 在一个进程里管理多个账号的客户端
+type ClientManager struct {
+	addr               string
+	opts               []Option // 所有账号共享的配置
+	clients            map[string]*Client
+	clientsLock        sync.RWMutex
+	connectConcurrency int
+}
+
+// NewClientManager 创建客户端管理者，opts为所有账号共享的配置(如协议版本、重连策略、心跳)
+// Outbox这类每个客户端独有的配置应在Add时传入
+func NewClientManager(addr string, opts ...Option) *ClientManager {
+	return &ClientManager{
+		addr:               addr,
+		opts:               opts,
+		clients:            make(map[string]*Client),
+		connectConcurrency: defaultConnectConcurrency,
+	}
+}
+
+// SetConnectConcurrency 设置StartAll时同时连接的客户端数量
+func (m *ClientManager) SetConnectConcurrency(concurrency int) {
+	if concurrency > 0 {
+		m.connectConcurrency = concurrency
+	}
+}
+
+// Add 添加账号并创建客户端(不会连接)，opts为这个账号的配置，会覆盖共享配置
+// 返回的客户端可以设置这个账号的回调
+func (m *ClientManager) Add(account Account, opts ...Option) (*Client, error) {
+	m.clientsLock.Lock()
+	defer m.clientsLock.Unlock()
+	if _, ok := m.clients[account.UID]; ok {
+		return nil, ErrAccountExists
+	}
+	clientOpts := make([]Option, 0, len(m.opts)+len(opts)+2)
+	clientOpts = append(clientOpts, m.opts...)
+	clientOpts = append(clientOpts, WithUID(account.UID), WithToken(account.Token))
+	clientOpts = append(clientOpts, opts...)
+	c := New(m.addr, clientOpts...)
+	m.clients[account.UID] = c
+	return c, nil
+}
+
+// Get 获取账号的客户端，不存在时返回nil
+func (m *ClientManager) Get(uid string) *Client {
+	m.clientsLock.RLock()
+	defer m.clientsLock.RUnlock()
+	return m.clients[uid]
+}
+
+// Remove 断开账号的客户端并移除
+func (m *ClientManager) Remove(ctx context.Context, uid string) error {
+	m.clientsLock.Lock()
+	c := m.clients[uid]
+	delete(m.clients, uid)
+	m.clientsLock.Unlock()
+	if c == nil {
+		return nil
+	}
+	if err := c.Disconnect(ctx, lmproto.ReasonSuccess, ""); err != nil && err != ErrClosed {
+		return err
+	}
+	return nil
+}
+
+// Clients 所有客户端
+func (m *ClientManager) Clients() []*Client {
+	m.clientsLock.RLock()
+	defer m.clientsLock.RUnlock()
+	clients := make([]*Client, 0, len(m.clients))
+	for _, c := range m.clients {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// Len 账号数量
+func (m *ClientManager) Len() int {
+	m.clientsLock.RLock()
+	defer m.clientsLock.RUnlock()
+	return len(m.clients)
+}
+
+// StartAll 连接所有未连接的客户端，部分失败时返回BatchError
+func (m *ClientManager) StartAll(ctx context.Context) error {
+	return m.each(func(c *Client) error {
+		if c.State() != StateIdle {
+			return nil
+		}
+		return c.ConnectContext(ctx)
+	})
+}
+
+// StopAll 断开所有客户端，断开后客户端不能再连接，部分失败时返回BatchError
+func (m *ClientManager) StopAll(ctx context.Context, reasonCode lmproto.ReasonCode, reason string) error {
+	return m.each(func(c *Client) error {
+		if err := c.Disconnect(ctx, reasonCode, reason); err != nil && err != ErrClosed {
+			return err
+		}
+		return nil
+	})
+}
+
+// 并发对所有客户端执行fn
+func (m *ClientManager) each(fn func(c *Client) error) error {
+	clients := m.Clients()
+	var (
+		errs     = BatchError{}
+		errsLock sync.Mutex
+		wg       sync.WaitGroup
+		limit    = make(chan struct{}, m.connectConcurrency)
+	)
+	for _, c := range clients {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func(c *Client) {
+			defer func() {
+				<-limit
+				wg.Done()
+			}()
+			if err := fn(c); err != nil {
+				errsLock.Lock()
+				errs[c.UID()] = err
+				errsLock.Unlock()
+			}
+		}(c)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientManager(t *testing.T) {
+	s := newTestServer(t, nil)
+	m := NewClientManager(s.addr(), WithHeartbeat(time.Second*5, time.Second, 3))
+	m.SetConnectConcurrency(4)
+	count := 20
+	for i := 0; i < count; i++ {
+		_, err := m.Add(Account{UID: fmt.Sprintf("uid%d", i), Token: "token"})
+		assert.NoError(t, err)
+	}
+	_, err := m.Add(Account{UID: "uid0"})
+	assert.Equal(t, ErrAccountExists, err)
+	assert.Equal(t, count, m.Len())
+
+	err = m.StartAll(context.Background())
+	assert.NoError(t, err)
+	uids := make(map[string]bool)
+	for len(uids) < count {
+		if packet, ok := (<-s.frames).(*lmproto.ConnectPacket); ok {
+			uids[packet.UID] = true
+		}
+	}
+	for _, c := range m.Clients() {
+		assert.Equal(t, StateConnected, c.State())
+	}
+	assert.Equal(t, "uid3", m.Get("uid3").UID())
+
+	err = m.Remove(context.Background(), "uid3")
+	assert.NoError(t, err)
+	assert.Nil(t, m.Get("uid3"))
+
+	err = m.StopAll(context.Background(), lmproto.ReasonSuccess, "")
+	assert.NoError(t, err)
+	for _, c := range m.Clients() {
+		assert.Equal(t, StateClosed, c.State())
+	}
+}
+
+func TestClientManagerStartError(t *testing.T) {
+	m := NewClientManager("tcp://127.0.0.1:1", WithoutReconnect())
+	m.Add(Account{UID: "1"})
+	m.Add(Account{UID: "2"})
+	err := m.StartAll(context.Background())
+	batchErr, ok := err.(BatchError)
+	assert.True(t, ok)
+	assert.Equal(t, 2, len(batchErr))
+}
@@ -1,18 +1,73 @@
 package client
 
-import "github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+)
 
 // Options Options
 type Options struct {
 	ProtoVersion uint8  // 协议版本
 	UID          string // 用户uid
 	Token        string // 连接IM的token
+	// ReconnectPolicy 重连策略，为nil时断开后不重连
+	ReconnectPolicy   *ReconnectPolicy
+	AckTimeout        time.Duration      // 等待发送回执的超时时间，超时后重发，0表示不超时
+	MaxRetries        int                // 发送消息超时后的最大重发次数
+	Outbox            Outbox             // 发件箱，为nil时使用内存发件箱
+	HeartbeatInterval time.Duration      // 发送ping的间隔
+	HeartbeatTimeout  time.Duration      // 等待pong的超时时间
+	HeartbeatMaxFails int                // 连续多少次没收到pong后断开连接重连
+	Logger            Logger             // 日志，默认不输出
+	SendInterceptors  []SendInterceptor  // 发送拦截器
+	RecvInterceptors  []RecvInterceptor  // 接收拦截器
+	StreamBufferSize  int                // Messages()和Acks()的缓冲大小
+	StreamPolicy      BackpressurePolicy // Messages()和Acks()缓冲满时的策略
+	Deduper           Deduper            // 收到消息的去重窗口，为nil时不去重
+	OrderWindow       time.Duration      // 有序投递时乱序消息的最长等待时间，0表示不保证顺序
+	RecvackBatchSize  int                // 批量回执时攒够多少个回执发送一次，0表示不批量回执
+	RecvackBatchDelay time.Duration      // 批量回执时第一个回执最多等待多久发送
+	RecvWorkers       int                // 并发处理收到的消息的worker数，0表示在读取循环里处理
+	RecvQueueSize     int                // 每个worker的队列长度，队列满时阻塞读取循环
+	// RecvQueueWaitBuckets 消息在处理队列里等待时间的直方图桶上限，从小到大
+	RecvQueueWaitBuckets []time.Duration
+	WriteQueueSize       int // 写入队列长度，满时发送方阻塞
+	// RateLimit 全局发送限速，为nil时不限速
+	RateLimit *RateLimit
+	// ChannelRateLimits 频道的发送限速，ChannelID为AnyChannelID时这个类型的每个频道各自限速
+	ChannelRateLimits []ChannelRateLimit
+	// RateLimitFailFast 超过限速时立即返回ErrRateLimited，默认等待
+	RateLimitFailFast bool
+	// Transport 传输层，为nil时根据连接地址的scheme选择(tcp://、unix://、tls://)
+	Transport Transport
+	// TLS tls://连接的配置，为nil时使用系统根证书校验服务端
+	TLS *TLSOptions
 }
 
 // NewOptions 创建默认配置
 func NewOptions() *Options {
 	return &Options{
-		ProtoVersion: lmproto.LatestVersion,
+		ProtoVersion:         lmproto.LatestVersion,
+		ReconnectPolicy:      NewReconnectPolicy(),
+		AckTimeout:           time.Second * 10,
+		MaxRetries:           3,
+		HeartbeatInterval:    time.Second * 20,
+		HeartbeatTimeout:     time.Second * 10,
+		HeartbeatMaxFails:    3,
+		Logger:               NopLogger{},
+		StreamBufferSize:     256,
+		StreamPolicy:         BackpressureBlock,
+		RecvQueueSize:        128,
+		RecvQueueWaitBuckets: defaultRecvQueueWaitBuckets,
+		WriteQueueSize:       1024,
 	}
 }
 
@@ -42,3 +97,359 @@ func WithToken(token string) Option {
 		return nil
 	}
 }
+
+// WithAckTimeout 设置等待发送回执的超时时间
+func WithAckTimeout(timeout time.Duration) Option {
+	return func(opts *Options) error {
+		opts.AckTimeout = timeout
+		return nil
+	}
+}
+
+// WithMaxRetries 设置发送消息超时后的最大重发次数
+func WithMaxRetries(maxRetries int) Option {
+	return func(opts *Options) error {
+		opts.MaxRetries = maxRetries
+		return nil
+	}
+}
+
+// WithHeartbeat 设置心跳，每interval发送一次ping，timeout内没收到pong算一次失败，连续失败maxFails次后断开连接重连
+func WithHeartbeat(interval, timeout time.Duration, maxFails int) Option {
+	return func(opts *Options) error {
+		if interval <= 0 || timeout <= 0 || maxFails < 1 {
+			return errors.New("心跳间隔和超时时间必须大于0，失败次数必须大于等于1！")
+		}
+		opts.HeartbeatInterval = interval
+		opts.HeartbeatTimeout = timeout
+		opts.HeartbeatMaxFails = maxFails
+		return nil
+	}
+}
+
+// WithLogger 设置日志
+func WithLogger(logger Logger) Option {
+	return func(opts *Options) error {
+		if logger == nil {
+			logger = NopLogger{}
+		}
+		opts.Logger = logger
+		return nil
+	}
+}
+
+// WithSendInterceptors 添加发送拦截器，按添加顺序执行
+func WithSendInterceptors(interceptors ...SendInterceptor) Option {
+	return func(opts *Options) error {
+		opts.SendInterceptors = append(opts.SendInterceptors, interceptors...)
+		return nil
+	}
+}
+
+// WithRecvInterceptors 添加接收拦截器，按添加顺序执行
+func WithRecvInterceptors(interceptors ...RecvInterceptor) Option {
+	return func(opts *Options) error {
+		opts.RecvInterceptors = append(opts.RecvInterceptors, interceptors...)
+		return nil
+	}
+}
+
+// WithStreamBuffer 设置Messages()和Acks()的缓冲大小和缓冲满时的策略
+func WithStreamBuffer(bufferSize int, policy BackpressurePolicy) Option {
+	return func(opts *Options) error {
+		if bufferSize < 0 {
+			return errors.New("缓冲大小不能小于0！")
+		}
+		opts.StreamBufferSize = bufferSize
+		opts.StreamPolicy = policy
+		return nil
+	}
+}
+
+// WithDeduper 设置收到消息的去重窗口
+func WithDeduper(deduper Deduper) Option {
+	return func(opts *Options) error {
+		opts.Deduper = deduper
+		return nil
+	}
+}
+
+// WithOrderedDelivery 按MessageSeq有序投递收到的消息，乱序的消息最多等待window，超时后触发OnGap并跳过缺失的序号
+// 可以用SetLastSeq恢复上次投递到的序号，没有恢复时第一条消息会等待window确定起点
+func WithOrderedDelivery(window time.Duration) Option {
+	return func(opts *Options) error {
+		opts.OrderWindow = window
+		return nil
+	}
+}
+
+// WithRecvackBatch 开启批量回执，攒够maxCount个回执或第一个回执等待了maxDelay后在一次写入中发送
+// 发送ping和断开连接时会带上攒着的回执
+func WithRecvackBatch(maxCount int, maxDelay time.Duration) Option {
+	return func(opts *Options) error {
+		opts.RecvackBatchSize = maxCount
+		opts.RecvackBatchDelay = maxDelay
+		return nil
+	}
+}
+
+// WithRecvWorkers 用workers个worker并发处理收到的消息，同一频道的消息按顺序处理
+// queueSize为每个worker的队列长度，队列满时阻塞读取循环
+// 开启后有序投递和消息回执以放入队列为准：消息处理失败时不回执，但不影响后面消息的投递
+func WithRecvWorkers(workers, queueSize int) Option {
+	return func(opts *Options) error {
+		if workers < 0 || queueSize < 0 {
+			return errors.New("worker数和队列长度不能小于0！")
+		}
+		opts.RecvWorkers = workers
+		opts.RecvQueueSize = queueSize
+		return nil
+	}
+}
+
+// WithRecvQueueWaitBuckets 设置消息在处理队列里等待时间的直方图桶上限
+func WithRecvQueueWaitBuckets(buckets ...time.Duration) Option {
+	return func(opts *Options) error {
+		for i := 1; i < len(buckets); i++ {
+			if buckets[i] <= buckets[i-1] {
+				return errors.New("直方图的桶上限必须从小到大！")
+			}
+		}
+		opts.RecvQueueWaitBuckets = buckets
+		return nil
+	}
+}
+
+// WithWriteQueueSize 设置写入队列长度，写入者会把队列里的多个包合并成一次写入
+func WithWriteQueueSize(size int) Option {
+	return func(opts *Options) error {
+		if size < 0 {
+			return errors.New("写入队列长度不能小于0！")
+		}
+		opts.WriteQueueSize = size
+		return nil
+	}
+}
+
+// WithRateLimit 设置全局发送限速，每秒最多发送rate条消息，最多突发burst条
+// 重连后重发发件箱里的消息和超时重发也受限速，总是等待令牌
+func WithRateLimit(rate float64, burst int) Option {
+	return func(opts *Options) error {
+		if rate <= 0 || burst < 1 {
+			return errors.New("限速的速率必须大于0，突发数必须大于等于1！")
+		}
+		opts.RateLimit = &RateLimit{Rate: rate, Burst: burst}
+		return nil
+	}
+}
+
+// WithChannelRateLimit 设置频道的发送限速，channel.ChannelID为AnyChannelID时这个类型的每个频道各自限速
+func WithChannelRateLimit(channel *Channel, rate float64, burst int) Option {
+	return func(opts *Options) error {
+		if rate <= 0 || burst < 1 {
+			return errors.New("限速的速率必须大于0，突发数必须大于等于1！")
+		}
+		opts.ChannelRateLimits = append(opts.ChannelRateLimits, ChannelRateLimit{
+			Channel:   *channel,
+			RateLimit: RateLimit{Rate: rate, Burst: burst},
+		})
+		return nil
+	}
+}
+
+// WithRateLimitFailFast 设置超过限速时是否立即返回ErrRateLimited
+func WithRateLimitFailFast(failFast bool) Option {
+	return func(opts *Options) error {
+		opts.RateLimitFailFast = failFast
+		return nil
+	}
+}
+
+// WithTransport 设置传输层，所有连接地址都使用这个传输层建立连接
+func WithTransport(transport Transport) Option {
+	return func(opts *Options) error {
+		opts.Transport = transport
+		return nil
+	}
+}
+
+// WithTLSRootCAs 设置校验服务端证书的根证书
+func WithTLSRootCAs(rootCAs *x509.CertPool) Option {
+	return func(opts *Options) error {
+		opts.tlsOptions().RootCAs = rootCAs
+		return nil
+	}
+}
+
+// WithTLSClientCertificate 添加客户端证书，服务端要求双向认证时使用
+func WithTLSClientCertificate(cert tls.Certificate) Option {
+	return func(opts *Options) error {
+		tlsOpts := opts.tlsOptions()
+		tlsOpts.Certificates = append(tlsOpts.Certificates, cert)
+		return nil
+	}
+}
+
+// WithTLSServerName 设置校验服务端证书的域名，默认为连接地址的主机名
+func WithTLSServerName(serverName string) Option {
+	return func(opts *Options) error {
+		opts.tlsOptions().ServerName = serverName
+		return nil
+	}
+}
+
+// WithTLSMinVersion 设置最低的TLS版本，如tls.VersionTLS13
+func WithTLSMinVersion(version uint16) Option {
+	return func(opts *Options) error {
+		if version < tls.VersionTLS10 || version > tls.VersionTLS13 {
+			return fmt.Errorf("不支持的TLS版本[%#x]！", version)
+		}
+		opts.tlsOptions().MinVersion = version
+		return nil
+	}
+}
+
+// WithTLSPinnedSPKI 添加固定的证书公钥，pin为SPKIPin返回的SHA256摘要(base64)
+// 设置后服务端的证书链里必须有一个证书的公钥匹配其中一个pin
+func WithTLSPinnedSPKI(pins ...string) Option {
+	return func(opts *Options) error {
+		for _, pin := range pins {
+			hash, err := base64.StdEncoding.DecodeString(pin)
+			if err != nil || len(hash) != sha256.Size {
+				return fmt.Errorf("证书公钥pin[%s]格式有误！", pin)
+			}
+		}
+		tlsOpts := opts.tlsOptions()
+		tlsOpts.PinnedSPKI = append(tlsOpts.PinnedSPKI, pins...)
+		return nil
+	}
+}
+
+// 获取TLS配置，没有时创建
+func (o *Options) tlsOptions() *TLSOptions {
+	if o.TLS == nil {
+		o.TLS = &TLSOptions{}
+	}
+	return o.TLS
+}
+
+// WithOutbox 设置发件箱，使用FileOutbox可以让没有收到回执的消息在进程重启后重发
+func WithOutbox(outbox Outbox) Option {
+	return func(opts *Options) error {
+		opts.Outbox = outbox
+		return nil
+	}
+}
+
+// WithReconnectPolicy 设置重连策略
+func WithReconnectPolicy(policy *ReconnectPolicy) Option {
+	return func(opts *Options) error {
+		opts.ReconnectPolicy = policy
+		return nil
+	}
+}
+
+// WithoutReconnect 断开后不重连，适用于一次性的工具
+func WithoutReconnect() Option {
+	return func(opts *Options) error {
+		opts.ReconnectPolicy = nil
+		return nil
+	}
+}
+
+// ReconnectPolicy 重连策略
+type ReconnectPolicy struct {
+	InitialDelay time.Duration   // 第一次重连前的等待时间
+	Multiplier   float64         // 每次重连失败后等待时间的增长倍数
+	MaxDelay     time.Duration   // 最大等待时间
+	Jitter       float64         // 等待时间的随机抖动比例(0~1)，避免大量客户端同时重连
+	MaxAttempts  int             // 最大重连次数，0表示不限制
+	OnGiveUp     func(err error) // 放弃重连时的回调，err为最后一次失败的原因
+	// ReconnectOnKick 被服务端踢下线后是否重连，默认不重连，避免同设备标示的客户端互踢
+	ReconnectOnKick bool
+}
+
+// NewReconnectPolicy 创建默认重连策略
+func NewReconnectPolicy() *ReconnectPolicy {
+	return &ReconnectPolicy{
+		InitialDelay: time.Second,
+		Multiplier:   2,
+		MaxDelay:     time.Second * 30,
+		Jitter:       0.2,
+	}
+}
+
+// Delay 第attempt次(从1开始)重连前的等待时间
+func (r *ReconnectPolicy) Delay(attempt int) time.Duration {
+	delay := float64(r.InitialDelay)
+	for i := 1; i < attempt && (r.MaxDelay <= 0 || delay < float64(r.MaxDelay)); i++ {
+		delay *= r.Multiplier
+	}
+	if r.MaxDelay > 0 && delay > float64(r.MaxDelay) {
+		delay = float64(r.MaxDelay)
+	}
+	if r.Jitter > 0 {
+		delay += delay * r.Jitter * (rand.Float64()*2 - 1)
+	}
+	if delay < 0 {
+		return 0
+	}
+	return time.Duration(delay)
+}
+
+// SendOptions 单条消息的发送配置
+type SendOptions struct {
+	AckTimeout time.Duration // 等待发送回执的超时时间，超时后重发，0表示不超时
+	MaxRetries int           // 超时后的最大重发次数
+	// RateLimitFailFast 超过限速时立即返回ErrRateLimited，为false时等待
+	RateLimitFailFast bool
+	Priority          Priority // 写入连接的优先级，默认PriorityInteractive
+}
+
+// newSendOptions 创建单条消息的发送配置，默认值取自客户端配置
+func newSendOptions(opts *Options) *SendOptions {
+	return &SendOptions{
+		AckTimeout:        opts.AckTimeout,
+		MaxRetries:        opts.MaxRetries,
+		RateLimitFailFast: opts.RateLimitFailFast,
+		Priority:          PriorityInteractive,
+	}
+}
+
+// SendOption 单条消息的发送参数项
+type SendOption func(*SendOptions) error
+
+// WithMessageAckTimeout 设置这条消息等待发送回执的超时时间
+func WithMessageAckTimeout(timeout time.Duration) SendOption {
+	return func(opts *SendOptions) error {
+		opts.AckTimeout = timeout
+		return nil
+	}
+}
+
+// WithMessageMaxRetries 设置这条消息超时后的最大重发次数
+func WithMessageMaxRetries(maxRetries int) SendOption {
+	return func(opts *SendOptions) error {
+		opts.MaxRetries = maxRetries
+		return nil
+	}
+}
+
+// WithMessageRateLimitFailFast 设置这条消息超过限速时是否立即返回ErrRateLimited
+func WithMessageRateLimitFailFast(failFast bool) SendOption {
+	return func(opts *SendOptions) error {
+		opts.RateLimitFailFast = failFast
+		return nil
+	}
+}
+
+// WithMessagePriority 设置这条消息写入连接的优先级，大批量的消息可以用PriorityBulk避免阻塞交互消息
+func WithMessagePriority(priority Priority) SendOption {
+	return func(opts *SendOptions) error {
+		if priority < PriorityControl || priority > PriorityBulk {
+			return fmt.Errorf("不支持的优先级[%d]！", priority)
+		}
+		opts.Priority = priority
+		return nil
+	}
+}
@@ -0,0 +1,36 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconnectPolicyDelay(t *testing.T) {
+	policy := &ReconnectPolicy{
+		InitialDelay: time.Second,
+		Multiplier:   2,
+		MaxDelay:     time.Second * 5,
+	}
+	assert.Equal(t, time.Second, policy.Delay(1))
+	assert.Equal(t, time.Second*2, policy.Delay(2))
+	assert.Equal(t, time.Second*4, policy.Delay(3))
+	assert.Equal(t, time.Second*5, policy.Delay(4))
+	assert.Equal(t, time.Second*5, policy.Delay(100))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		delay := policy.Delay(1)
+		assert.True(t, delay >= time.Millisecond*500 && delay <= time.Millisecond*1500)
+	}
+}
+
+func TestWithHeartbeat(t *testing.T) {
+	opts := NewOptions()
+	assert.NoError(t, WithHeartbeat(time.Second, time.Second, 1)(opts))
+	assert.Equal(t, time.Second, opts.HeartbeatInterval)
+	assert.Error(t, WithHeartbeat(0, time.Second, 1)(opts))
+	assert.Error(t, WithHeartbeat(time.Second, 0, 1)(opts))
+	assert.Error(t, WithHeartbeat(time.Second, time.Second, 0)(opts))
+}
@@ -0,0 +1,231 @@
+package client
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+)
+
+// OnGap 有序投递时等待超时后仍缺少[from, to]范围的消息，应用可以据此同步历史消息
+type OnGap func(from uint32, to uint32)
+
+// SetOnGap 设置消息序号缺失事件
+func (c *Client) SetOnGap(onGap OnGap) {
+	c.onGap = onGap
+}
+
+// 有序投递时等待超时，跳过缺失的消息
+func (c *Client) handleGap(from, to uint32) {
+	c.logger.Warn("消息序号缺失！", "from", from, "to", to)
+	c.stats.gaps.Inc()
+	if c.onGap != nil {
+		c.onGap(from, to)
+	}
+}
+
+// LastSeq 有序投递时最后按顺序投递的消息序号，应用可以保存下来，下次启动时用SetLastSeq恢复
+func (c *Client) LastSeq() uint32 {
+	if c.sequencer == nil {
+		return 0
+	}
+	return c.sequencer.getLastSeq()
+}
+
+// SetLastSeq 设置有序投递的起点，之后只投递序号大于seq的消息，应在Connect前调用
+// 没有设置时以收到第一条消息后window内收到的最小序号为起点
+func (c *Client) SetLastSeq(seq uint32) {
+	if c.sequencer != nil {
+		c.sequencer.setLastSeq(seq)
+	}
+}
+
+// 按MessageSeq有序投递收到的消息，乱序的消息最多等待window，超时后跳过缺失的序号
+// MessageSeq为0的消息(不存储的消息)直接投递
+// 没有设置起点时，收到第一条消息后等待window，以期间收到的最小序号为起点
+type sequencer struct {
+	window      time.Duration
+	deliver     func(packet *lmproto.RecvPacket) error // 投递成功后才推进序号
+	ack         func(packet *lmproto.RecvPacket)       // 回执已经投递过的消息
+	onGap       func(from, to uint32)
+	deliverLock sync.Mutex // 保证投递的顺序，投递和onGap时不持有lock，回调里可以断开客户端
+	lock        sync.Mutex
+	seeded      bool                           // 是否已经有起点
+	floor       uint32                         // 自己确定的起点，比它小的消息没有投递过
+	lastSeq     uint32                         // 最后投递的序号
+	pending     map[uint32]*lmproto.RecvPacket // 等待前面的消息的乱序消息
+	timer       *time.Timer
+	timerGen    int    // 每次重设等待时加1，用于忽略过期的超时
+	gapStart    uint32 // 开始等待时的lastSeq
+	stopped     bool
+}
+
+func newSequencer(window time.Duration, deliver func(packet *lmproto.RecvPacket) error, ack func(packet *lmproto.RecvPacket), onGap func(from, to uint32)) *sequencer {
+	return &sequencer{
+		window:  window,
+		deliver: deliver,
+		ack:     ack,
+		onGap:   onGap,
+		pending: make(map[uint32]*lmproto.RecvPacket),
+	}
+}
+
+func (s *sequencer) getLastSeq() uint32 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.lastSeq
+}
+
+// 设置起点，丢弃不比起点大的乱序消息
+func (s *sequencer) setLastSeq(seq uint32) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.seeded = true
+	s.floor = 0
+	s.lastSeq = seq
+	for pendingSeq := range s.pending {
+		if pendingSeq <= seq {
+			delete(s.pending, pendingSeq)
+		}
+	}
+	s.rearm()
+}
+
+func (s *sequencer) push(packet *lmproto.RecvPacket) {
+	s.deliverLock.Lock()
+	defer s.deliverLock.Unlock()
+	s.lock.Lock()
+	if s.stopped {
+		s.lock.Unlock()
+		return
+	}
+	seq := packet.MessageSeq
+	if !s.seeded && seq == 1 { // 没有比1更小的序号，不用等待
+		s.seeded = true
+		s.floor = 1
+	}
+	switch {
+	case seq == 0:
+		s.lock.Unlock()
+		s.deliver(packet)
+		return
+	case !s.seeded:
+		s.pending[seq] = packet
+	case seq == s.lastSeq+1:
+		s.lock.Unlock()
+		s.deliverFrom(packet)
+		return
+	case seq < s.floor: // 起点确定后才到达的更早的消息，没有投递过，直接投递
+		s.lock.Unlock()
+		s.deliver(packet)
+		return
+	case seq <= s.lastSeq: // 已经投递过
+		s.lock.Unlock()
+		s.ack(packet)
+		return
+	default:
+		s.pending[seq] = packet
+	}
+	s.rearm()
+	s.lock.Unlock()
+}
+
+// 投递packet和接上了序号的乱序消息，调用时持有deliverLock
+func (s *sequencer) deliverFrom(packet *lmproto.RecvPacket) {
+	for packet != nil {
+		err := s.deliver(packet)
+		s.lock.Lock()
+		if err == nil {
+			s.lastSeq = packet.MessageSeq
+			delete(s.pending, packet.MessageSeq) // 重新投递成功时可能还在等待中
+		}
+		if s.stopped {
+			s.lock.Unlock()
+			return
+		}
+		if err != nil { // 投递失败的消息留在等待中，服务端重新投递或等待超时后再投递，不跳过它
+			s.pending[packet.MessageSeq] = packet
+		}
+		packet = nil
+		if err == nil {
+			if packet = s.pending[s.lastSeq+1]; packet != nil {
+				delete(s.pending, packet.MessageSeq)
+			}
+		}
+		if packet == nil {
+			s.rearm()
+		}
+		s.lock.Unlock()
+	}
+}
+
+// 没有乱序消息时停止等待，缺失的序号变化时重新开始等待
+func (s *sequencer) rearm() {
+	if len(s.pending) == 0 {
+		if s.timer != nil {
+			s.timer.Stop()
+			s.timer = nil
+		}
+		return
+	}
+	if s.timer != nil && s.gapStart == s.lastSeq {
+		return
+	}
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.timerGen++
+	gen := s.timerGen
+	s.gapStart = s.lastSeq
+	s.timer = time.AfterFunc(s.window, func() {
+		s.handleTimeout(gen)
+	})
+}
+
+// 等待超时，没有起点时以最小的序号为起点，否则报告缺失的序号并跳过
+// 最小的序号就是下一个要投递的(之前投递失败的)时没有缺失，重新投递它
+func (s *sequencer) handleTimeout(gen int) {
+	s.deliverLock.Lock()
+	defer s.deliverLock.Unlock()
+	s.lock.Lock()
+	if s.stopped || gen != s.timerGen || len(s.pending) == 0 {
+		s.lock.Unlock()
+		return
+	}
+	seqs := make([]uint32, 0, len(s.pending))
+	for seq := range s.pending {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool {
+		return seqs[i] < seqs[j]
+	})
+	from, to := s.lastSeq+1, seqs[0]-1
+	gap := s.seeded && from <= to
+	if !s.seeded {
+		s.seeded = true
+		s.floor = seqs[0]
+	}
+	s.lastSeq = to
+	s.timer = nil
+	packet := s.pending[seqs[0]]
+	delete(s.pending, seqs[0])
+	s.lock.Unlock()
+
+	if gap && s.onGap != nil {
+		s.onGap(from, to)
+	}
+	s.deliverFrom(packet)
+}
+
+// 客户端关闭时停止等待
+func (s *sequencer) stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stopped = true
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.pending = make(map[uint32]*lmproto.RecvPacket)
+}
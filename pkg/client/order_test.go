@@ -0,0 +1,168 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSequencer(t *testing.T) {
+	var (
+		delivered []uint32
+		acked     []uint32
+		gaps      = make(chan [2]uint32, 1)
+		fail      = map[uint32]bool{}
+	)
+	s := newSequencer(time.Millisecond*50, func(packet *lmproto.RecvPacket) error {
+		if fail[packet.MessageSeq] {
+			delete(fail, packet.MessageSeq)
+			return assert.AnError
+		}
+		delivered = append(delivered, packet.MessageSeq)
+		return nil
+	}, func(packet *lmproto.RecvPacket) {
+		acked = append(acked, packet.MessageSeq)
+	}, func(from, to uint32) {
+		gaps <- [2]uint32{from, to}
+	})
+	push := func(seqs ...uint32) {
+		for _, seq := range seqs {
+			s.push(&lmproto.RecvPacket{MessageSeq: seq})
+		}
+	}
+	deliveredSeqs := func() []uint32 {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		return append([]uint32(nil), delivered...)
+	}
+
+	// 没有起点时等待window，以期间收到的最小序号为起点
+	push(5, 7, 4, 0)
+	assert.Equal(t, []uint32{0}, deliveredSeqs())
+	assert.Eventually(t, func() bool {
+		return len(deliveredSeqs()) == 3
+	}, time.Second, time.Millisecond*5)
+	assert.Equal(t, []uint32{0, 4, 5}, deliveredSeqs())
+
+	// 乱序的消息等前面的消息到了再投递
+	push(8, 6)
+	assert.Equal(t, []uint32{0, 4, 5, 6, 7, 8}, deliveredSeqs())
+
+	// 已经投递过的消息只回执，比起点还早的消息直接投递
+	push(7, 3)
+	assert.Equal(t, []uint32{7}, acked)
+	assert.Equal(t, []uint32{0, 4, 5, 6, 7, 8, 3}, deliveredSeqs())
+
+	// 缺失的消息没有到，超时后跳过
+	push(11, 12)
+	assert.Equal(t, [2]uint32{9, 10}, <-gaps)
+	assert.Equal(t, []uint32{0, 4, 5, 6, 7, 8, 3, 11, 12}, deliveredSeqs())
+
+	// 投递失败不推进序号，重新投递后继续
+	fail[13] = true
+	push(13, 14)
+	assert.Equal(t, []uint32{0, 4, 5, 6, 7, 8, 3, 11, 12}, deliveredSeqs())
+	push(13)
+	assert.Equal(t, []uint32{0, 4, 5, 6, 7, 8, 3, 11, 12, 13, 14}, deliveredSeqs())
+	select {
+	case gap := <-gaps:
+		t.Fatalf("unexpected gap %v", gap)
+	case <-time.After(time.Millisecond * 100):
+	}
+	s.stop()
+
+	// 投递失败的消息不会被当作缺失跳过，等待超时后重新投递，之后服务端重新投递的只回执
+	var failGaps [][2]uint32
+	delivered, acked = nil, nil
+	fail = map[uint32]bool{2: true}
+	s = newSequencer(time.Millisecond*50, func(packet *lmproto.RecvPacket) error {
+		if fail[packet.MessageSeq] {
+			delete(fail, packet.MessageSeq)
+			return assert.AnError
+		}
+		delivered = append(delivered, packet.MessageSeq)
+		return nil
+	}, func(packet *lmproto.RecvPacket) {
+		acked = append(acked, packet.MessageSeq)
+	}, func(from, to uint32) {
+		failGaps = append(failGaps, [2]uint32{from, to})
+	})
+	s.setLastSeq(1)
+	push(2, 3)
+	assert.Empty(t, deliveredSeqs())
+	time.Sleep(time.Millisecond * 100)
+	push(2)
+	assert.Equal(t, []uint32{2, 3}, deliveredSeqs())
+	assert.Equal(t, []uint32{2}, acked)
+	s.deliverLock.Lock()
+	assert.Empty(t, failGaps)
+	s.deliverLock.Unlock()
+	s.stop()
+
+	// 设置了起点时不再等待，不比起点大的消息只回执
+	delivered, acked = nil, nil
+	s = newSequencer(time.Millisecond*50, func(packet *lmproto.RecvPacket) error {
+		delivered = append(delivered, packet.MessageSeq)
+		return nil
+	}, func(packet *lmproto.RecvPacket) {
+		acked = append(acked, packet.MessageSeq)
+	}, nil)
+	s.setLastSeq(10)
+	push(11, 10)
+	assert.Equal(t, []uint32{11}, delivered)
+	assert.Equal(t, []uint32{10}, acked)
+	assert.Equal(t, uint32(11), s.getLastSeq())
+	s.stop()
+}
+
+func TestOrderedDelivery(t *testing.T) {
+	s := newTestServer(t, nil)
+	c := New(s.addr(), WithUID("1"), WithToken("1234"), WithOrderedDelivery(time.Millisecond*50))
+	gapChan := make(chan [2]uint32, 1)
+	c.SetOnGap(func(from, to uint32) {
+		gapChan <- [2]uint32{from, to}
+	})
+	messages := c.Messages()
+	err := c.Connect()
+	assert.NoError(t, err)
+	defer c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+	conn := <-s.conns
+
+	for _, seq := range []uint32{1, 3, 2, 6} {
+		s.write(conn, &lmproto.RecvPacket{MessageID: int64(seq), MessageSeq: seq, ChannelID: "test", ChannelType: 1})
+	}
+	for _, seq := range []uint32{1, 2, 3} {
+		assert.Equal(t, seq, (<-messages).MessageSeq)
+	}
+	assert.Equal(t, [2]uint32{4, 5}, <-gapChan)
+	assert.Equal(t, uint32(6), (<-messages).MessageSeq)
+	assert.Equal(t, int64(1), c.Stats().Gaps)
+}
+
+func TestOrderedDeliveryDisconnectInHandler(t *testing.T) {
+	s := newTestServer(t, nil)
+	c := New(s.addr(), WithUID("1"), WithToken("1234"), WithOrderedDelivery(time.Millisecond*50))
+	c.SetLastSeq(1)
+	done := make(chan struct{})
+	c.SetOnRecv(func(packet *lmproto.RecvPacket) error {
+		c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+		close(done)
+		return nil
+	})
+	err := c.Connect()
+	assert.NoError(t, err)
+	conn := <-s.conns
+
+	s.write(conn, &lmproto.RecvPacket{MessageID: 2, MessageSeq: 2, ChannelID: "test", ChannelType: 1})
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Disconnect in OnRecv blocked")
+	}
+	assert.Eventually(t, func() bool {
+		return c.LastSeq() == 2
+	}, time.Second, time.Millisecond*5)
+}
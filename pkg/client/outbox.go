@@ -0,0 +1,275 @@
+package client
+
+import (
+	"os"
+	"sync"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+	"github.com/pkg/errors"
+)
+
+// Outbox 发件箱，保存还没有收到发送回执的消息，连接后会重发其中的消息
+type Outbox interface {
+	// Add 添加消息
+	Add(packet *lmproto.SendPacket) error
+	// Remove 移除消息(收到回执或发送失败)
+	Remove(clientSeq uint64) error
+	// List 按添加顺序返回所有消息
+	List() ([]*lmproto.SendPacket, error)
+	// Len 消息数量
+	Len() int
+	// Close 关闭发件箱
+	Close() error
+}
+
+// MemoryOutbox 内存发件箱，进程退出后消息丢失
+type MemoryOutbox struct {
+	packets []*lmproto.SendPacket
+	lock    sync.Mutex
+}
+
+// NewMemoryOutbox 创建内存发件箱
+func NewMemoryOutbox() *MemoryOutbox {
+	return &MemoryOutbox{
+		packets: make([]*lmproto.SendPacket, 0),
+	}
+}
+
+// Add 添加消息
+func (m *MemoryOutbox) Add(packet *lmproto.SendPacket) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.packets = append(m.packets, packet)
+	return nil
+}
+
+// Remove 移除消息
+func (m *MemoryOutbox) Remove(clientSeq uint64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.packets = removePacket(m.packets, clientSeq)
+	return nil
+}
+
+// List 按添加顺序返回所有消息
+func (m *MemoryOutbox) List() ([]*lmproto.SendPacket, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]*lmproto.SendPacket(nil), m.packets...), nil
+}
+
+// Len 消息数量
+func (m *MemoryOutbox) Len() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.packets)
+}
+
+// Close 关闭发件箱
+func (m *MemoryOutbox) Close() error {
+	return nil
+}
+
+// 日志记录类型
+const (
+	journalAdd    uint8 = 1 // 添加消息
+	journalRemove uint8 = 2 // 移除消息
+)
+
+// 日志中已移除的记录超过这个数量并且超过剩余消息数量时压缩日志
+const journalCompactThreshold = 64
+
+// FileOutbox 文件发件箱，消息以只追加的日志保存到文件，进程重启后可以恢复
+// 每条记录为4字节的长度加记录内容，添加记录包含ClientSeq、ClientMsgNo、频道、标记和消息内容，移除记录只包含ClientSeq
+type FileOutbox struct {
+	path    string
+	file    *os.File
+	packets []*lmproto.SendPacket // 按添加顺序保存的消息
+	removed int                   // 日志中移除记录的数量
+	lock    sync.Mutex
+}
+
+// NewFileOutbox 创建文件发件箱，文件已存在时加载其中的消息
+func NewFileOutbox(path string) (*FileOutbox, error) {
+	f := &FileOutbox{
+		path:    path,
+		packets: make([]*lmproto.SendPacket, 0),
+	}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	if err := f.compact(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Add 添加消息
+func (f *FileOutbox) Add(packet *lmproto.SendPacket) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.append(encodeJournalAdd(packet), true); err != nil {
+		return err
+	}
+	f.packets = append(f.packets, packet)
+	return nil
+}
+
+// Remove 移除消息，日志中移除的记录较多时压缩日志
+func (f *FileOutbox) Remove(clientSeq uint64) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	count := len(f.packets)
+	f.packets = removePacket(f.packets, clientSeq)
+	if len(f.packets) == count {
+		return nil
+	}
+	if len(f.packets) == 0 { // 没有消息了，直接清空日志
+		f.removed = 0
+		return f.file.Truncate(0) // 文件以追加模式打开，清空后从头写入
+	}
+	enc := lmproto.NewEncoder()
+	enc.WriteUint8(journalRemove)
+	enc.WriteUint64(clientSeq)
+	if err := f.append(enc.Bytes(), false); err != nil {
+		return err
+	}
+	f.removed++
+	if f.removed >= journalCompactThreshold && f.removed > len(f.packets) {
+		return f.compact()
+	}
+	return nil
+}
+
+// List 按添加顺序返回所有消息
+func (f *FileOutbox) List() ([]*lmproto.SendPacket, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]*lmproto.SendPacket(nil), f.packets...), nil
+}
+
+// Len 消息数量
+func (f *FileOutbox) Len() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.packets)
+}
+
+// Close 关闭发件箱
+func (f *FileOutbox) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.file.Close()
+}
+
+// 追加一条记录，sync为true时等待写入磁盘
+func (f *FileOutbox) append(record []byte, sync bool) error {
+	return appendRecord(f.file, record, sync)
+}
+
+// 重放日志
+func (f *FileOutbox) load() error {
+	return readRecords(f.path, func(record []byte) error {
+		return errors.Wrap(f.replay(record), "解析发件箱日志失败！")
+	})
+}
+
+func (f *FileOutbox) replay(record []byte) error {
+	dec := lmproto.NewDecoder(record)
+	op, err := dec.Uint8()
+	if err != nil {
+		return err
+	}
+	switch op {
+	case journalAdd:
+		packet, err := decodeJournalAdd(dec)
+		if err != nil {
+			return err
+		}
+		f.packets = append(f.packets, packet)
+	case journalRemove:
+		clientSeq, err := dec.Uint64()
+		if err != nil {
+			return err
+		}
+		f.packets = removePacket(f.packets, clientSeq)
+	default:
+		return errors.Errorf("未知的日志记录类型[%d]！", op)
+	}
+	return nil
+}
+
+// 只保留现有消息重写日志
+func (f *FileOutbox) compact() error {
+	records := make([][]byte, 0, len(f.packets))
+	for _, packet := range f.packets {
+		records = append(records, encodeJournalAdd(packet))
+	}
+	file, err := rewriteJournal(f.path, records)
+	if err != nil {
+		return err
+	}
+	if f.file != nil {
+		f.file.Close()
+	}
+	f.file = file
+	f.removed = 0
+	return nil
+}
+
+func encodeJournalAdd(packet *lmproto.SendPacket) []byte {
+	enc := lmproto.NewEncoder()
+	enc.WriteUint8(journalAdd)
+	enc.WriteUint64(packet.ClientSeq)
+	enc.WriteString(packet.ClientMsgNo)
+	enc.WriteString(packet.ChannelID)
+	enc.WriteUint8(packet.ChannelType)
+	enc.WriteUint8(uint8(encodeBool(packet.SyncOnce)<<2 | encodeBool(packet.RedDot)<<1 | encodeBool(packet.NoPersist)))
+	enc.WriteBytes(packet.Payload)
+	return enc.Bytes()
+}
+
+func decodeJournalAdd(dec *lmproto.Decoder) (*lmproto.SendPacket, error) {
+	packet := &lmproto.SendPacket{}
+	var err error
+	if packet.ClientSeq, err = dec.Uint64(); err != nil {
+		return nil, err
+	}
+	if packet.ClientMsgNo, err = dec.String(); err != nil {
+		return nil, err
+	}
+	if packet.ChannelID, err = dec.String(); err != nil {
+		return nil, err
+	}
+	if packet.ChannelType, err = dec.Uint8(); err != nil {
+		return nil, err
+	}
+	var flags uint8
+	if flags, err = dec.Uint8(); err != nil {
+		return nil, err
+	}
+	packet.NoPersist = flags&0x01 > 0
+	packet.RedDot = flags>>1&0x01 > 0
+	packet.SyncOnce = flags>>2&0x01 > 0
+	if packet.Payload, err = dec.BinaryAll(); err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+func encodeBool(b bool) (i int) {
+	if b {
+		i = 1
+	}
+	return
+}
+
+// 从消息列表中移除ClientSeq对应的消息
+func removePacket(packets []*lmproto.SendPacket, clientSeq uint64) []*lmproto.SendPacket {
+	for i, packet := range packets {
+		if packet.ClientSeq == clientSeq {
+			return append(packets[:i], packets[i+1:]...)
+		}
+	}
+	return packets
+}
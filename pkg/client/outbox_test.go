@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileOutbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "outbox")
+
+	outbox, err := NewFileOutbox(path)
+	assert.NoError(t, err)
+	for i := 1; i <= 3; i++ {
+		err = outbox.Add(&lmproto.SendPacket{
+			Framer:      lmproto.Framer{RedDot: true},
+			ClientSeq:   uint64(i),
+			ClientMsgNo: "msgno",
+			ChannelID:   "test",
+			ChannelType: 2,
+			Payload:     []byte("hello"),
+		})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, outbox.Remove(2))
+	assert.NoError(t, outbox.Close())
+
+	// 模拟写入过程中进程退出，最后一条记录不完整
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	file.Write([]byte{0, 0, 0, 100, journalAdd})
+	file.Close()
+
+	outbox, err = NewFileOutbox(path)
+	assert.NoError(t, err)
+	defer outbox.Close()
+	packets, err := outbox.List()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(packets))
+	assert.Equal(t, uint64(1), packets[0].ClientSeq)
+	assert.Equal(t, uint64(3), packets[1].ClientSeq)
+	assert.Equal(t, "msgno", packets[1].ClientMsgNo)
+	assert.Equal(t, "test", packets[1].ChannelID)
+	assert.Equal(t, uint8(2), packets[1].ChannelType)
+	assert.Equal(t, true, packets[1].RedDot)
+	assert.Equal(t, []byte("hello"), packets[1].Payload)
+
+	// 消息全部移除后日志被清空
+	assert.NoError(t, outbox.Remove(1))
+	assert.NoError(t, outbox.Remove(3))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), info.Size())
+}
+
+func TestFileOutboxCompact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "outbox")
+
+	outbox, err := NewFileOutbox(path)
+	assert.NoError(t, err)
+	defer outbox.Close()
+	assert.NoError(t, outbox.Add(&lmproto.SendPacket{ClientSeq: 1, ChannelID: "test"}))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	size := info.Size()
+	for i := 2; i < journalCompactThreshold+2; i++ {
+		assert.NoError(t, outbox.Add(&lmproto.SendPacket{ClientSeq: uint64(i), ChannelID: "test"}))
+		assert.NoError(t, outbox.Remove(uint64(i)))
+	}
+	info, err = os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, size, info.Size())
+}
+
+func TestOutboxResendAfterRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "outbox")
+
+	// 第一个进程：服务端不回发送回执
+	s := newTestServer(t, func(s *testServer, conn net.Conn, frame lmproto.Frame) {
+		if frame.GetPacketType() != lmproto.SEND {
+			defaultTestHandler(s, conn, frame)
+		}
+	})
+	outbox, err := NewFileOutbox(path)
+	assert.NoError(t, err)
+	c := New(s.addr(), WithUID("1"), WithToken("1234"), WithOutbox(outbox))
+	assert.NoError(t, c.Connect())
+	assert.NoError(t, c.SendMessage(NewChannel("test", 1), []byte("hello"), WithMessageAckTimeout(0)))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	c.Disconnect(ctx, lmproto.ReasonSuccess, "")
+
+	// 第二个进程：重新加载发件箱并重发
+	s = newTestServer(t, nil)
+	outbox, err = NewFileOutbox(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, outbox.Len())
+	c = New(s.addr(), WithUID("1"), WithToken("1234"), WithOutbox(outbox))
+	assert.Equal(t, uint64(1), c.clientIDGen.Load())
+	assert.NoError(t, c.Connect())
+	for frame := range s.frames {
+		if packet, ok := frame.(*lmproto.SendPacket); ok {
+			assert.Equal(t, true, packet.DUP)
+			assert.Equal(t, []byte("hello"), packet.Payload)
+			break
+		}
+	}
+	assert.Eventually(t, func() bool {
+		return outbox.Len() == 0
+	}, time.Second, time.Millisecond*10)
+	c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+}
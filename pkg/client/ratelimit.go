@@ -0,0 +1,214 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+)
+
+// ErrRateLimited 发送速率超过限制
+var ErrRateLimited = errors.New("发送速率超过限制！")
+
+// 按频道限速时最多保存的令牌桶数，超过时清理已经装满(空闲)的令牌桶
+const maxChannelBuckets = 1024
+
+// RateLimit 令牌桶限速，每秒生成Rate个令牌，最多攒Burst个
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// ChannelRateLimit 频道的发送限速
+type ChannelRateLimit struct {
+	Channel Channel
+	RateLimit
+}
+
+// 令牌桶
+type tokenBucket struct {
+	limit  RateLimit
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time // 上次计算令牌的时间
+}
+
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   now,
+	}
+}
+
+// 补充到now为止生成的令牌
+func (b *tokenBucket) advance(now time.Time) {
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+		if b.tokens > float64(b.limit.Burst) {
+			b.tokens = float64(b.limit.Burst)
+		}
+		b.last = now
+	}
+}
+
+// 预支一个令牌，返回需要等待的时间
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.advance(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.limit.Rate * float64(time.Second))
+}
+
+// 有令牌时取走一个
+func (b *tokenBucket) tryTake(now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.advance(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// 归还一个令牌
+func (b *tokenBucket) giveBack() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.tokens++
+	if b.tokens > float64(b.limit.Burst) {
+		b.tokens = float64(b.limit.Burst)
+	}
+}
+
+// 令牌桶是否已经装满
+func (b *tokenBucket) full(now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.advance(now)
+	return b.tokens >= float64(b.limit.Burst)
+}
+
+// 发送限速，全局一个令牌桶，频道各一个令牌桶
+type rateLimiter struct {
+	global         *tokenBucket
+	channelLimits  map[channelKey]RateLimit // ChannelID为AnyChannelID时这个类型的每个频道各自限速
+	channelBuckets map[channelKey]*tokenBucket
+	lock           sync.Mutex
+}
+
+// 创建发送限速，没有任何限速时返回nil
+func newRateLimiter(global *RateLimit, channelLimits []ChannelRateLimit) *rateLimiter {
+	if global == nil && len(channelLimits) == 0 {
+		return nil
+	}
+	r := &rateLimiter{
+		channelLimits:  make(map[channelKey]RateLimit, len(channelLimits)),
+		channelBuckets: make(map[channelKey]*tokenBucket),
+	}
+	if global != nil {
+		r.global = newTokenBucket(*global, time.Now())
+	}
+	for _, limit := range channelLimits {
+		r.channelLimits[channelKey{channelID: limit.Channel.ChannelID, channelType: limit.Channel.ChannelType}] = limit.RateLimit
+	}
+	return r
+}
+
+// 获取频道的令牌桶，没有限速时返回nil
+func (r *rateLimiter) channelBucket(channelID string, channelType uint8, now time.Time) *tokenBucket {
+	key := channelKey{channelID: channelID, channelType: channelType}
+	limit, ok := r.channelLimits[key]
+	if !ok {
+		if limit, ok = r.channelLimits[channelKey{channelID: AnyChannelID, channelType: channelType}]; !ok {
+			return nil
+		}
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	bucket := r.channelBuckets[key]
+	if bucket == nil {
+		if len(r.channelBuckets) >= maxChannelBuckets {
+			for k, b := range r.channelBuckets {
+				if b.full(now) {
+					delete(r.channelBuckets, k)
+				}
+			}
+		}
+		bucket = newTokenBucket(limit, now)
+		r.channelBuckets[key] = bucket
+	}
+	return bucket
+}
+
+// 等待发送令牌，failFast为true时没有令牌立即返回ErrRateLimited，返回等待的时间
+func (r *rateLimiter) wait(ctx context.Context, packet *lmproto.SendPacket, failFast bool) (time.Duration, error) {
+	now := time.Now()
+	buckets := make([]*tokenBucket, 0, 2)
+	if r.global != nil {
+		buckets = append(buckets, r.global)
+	}
+	if bucket := r.channelBucket(packet.ChannelID, packet.ChannelType, now); bucket != nil {
+		buckets = append(buckets, bucket)
+	}
+	if failFast {
+		for i, bucket := range buckets {
+			if !bucket.tryTake(now) {
+				for _, taken := range buckets[:i] {
+					taken.giveBack()
+				}
+				return 0, ErrRateLimited
+			}
+		}
+		return 0, nil
+	}
+	var delay time.Duration
+	for _, bucket := range buckets {
+		if d := bucket.reserve(now); d > delay {
+			delay = d
+		}
+	}
+	if delay <= 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		for _, bucket := range buckets {
+			bucket.giveBack()
+		}
+		return time.Since(now), ctx.Err()
+	}
+}
+
+// 重发的消息也占用令牌，总是等待而不是立即失败，客户端关闭时返回ErrClosed
+func (c *Client) waitResend(packet *lmproto.SendPacket) error {
+	if c.limiter == nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.closeChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	waited, err := c.limiter.wait(ctx, packet, false)
+	if err != nil {
+		return ErrClosed
+	}
+	c.stats.rateLimitWait.observe(waited)
+	return nil
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(RateLimit{Rate: 10, Burst: 2}, now)
+	assert.True(t, b.tryTake(now))
+	assert.True(t, b.tryTake(now))
+	assert.False(t, b.tryTake(now))
+	assert.True(t, b.tryTake(now.Add(time.Millisecond*100)))
+
+	now = now.Add(time.Millisecond * 100)
+	assert.Equal(t, time.Millisecond*100, b.reserve(now))
+	assert.Equal(t, time.Millisecond*200, b.reserve(now))
+	b.giveBack()
+	assert.Equal(t, time.Millisecond*200, b.reserve(now))
+	assert.True(t, b.full(now.Add(time.Second)))
+}
+
+func TestRateLimit(t *testing.T) {
+	s := newTestServer(t, nil)
+	c := New(s.addr(), WithUID("1"), WithToken("1234"),
+		WithRateLimit(1000, 100),
+		WithChannelRateLimit(NewChannel(AnyChannelID, 2), 20, 1),
+		WithRateLimitFailFast(true))
+	err := c.Connect()
+	assert.NoError(t, err)
+	defer c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+
+	// 每个群各自限速
+	assert.NoError(t, c.SendMessage(NewChannel("group1", 2), []byte("hello")))
+	assert.NoError(t, c.SendMessage(NewChannel("group2", 2), []byte("hello")))
+	assert.Equal(t, ErrRateLimited, c.SendMessage(NewChannel("group1", 2), []byte("hello")))
+	// 个人频道不受群的限速
+	assert.NoError(t, c.SendMessage(NewChannel("user", 1), []byte("hello")))
+
+	// 等待令牌
+	start := time.Now()
+	err = c.SendMessage(NewChannel("group1", 2), []byte("hello"), WithMessageRateLimitFailFast(false))
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) >= time.Millisecond*30)
+
+	// 等待时ctx结束
+	assert.Equal(t, ErrRateLimited, c.SendMessage(NewChannel("group1", 2), []byte("hello")))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	err = c.SendMessageContext(ctx, NewChannel("group1", 2), []byte("hello"), WithMessageRateLimitFailFast(false))
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	stats := c.Stats()
+	assert.Equal(t, int64(2), stats.RateLimited)
+	assert.Equal(t, int64(4), stats.RateLimitWait.Count)
+	assert.True(t, stats.RateLimitWait.Sum >= time.Millisecond*30)
+}
+
+func TestRateLimitResend(t *testing.T) {
+	var acking atomic.Bool
+	sent := make(chan time.Time, 16)
+	s := newTestServer(t, func(s *testServer, conn net.Conn, frame lmproto.Frame) {
+		if packet, ok := frame.(*lmproto.SendPacket); ok {
+			if packet.DUP {
+				sent <- time.Now()
+			}
+			if !acking.Load() {
+				return
+			}
+		}
+		defaultTestHandler(s, conn, frame)
+	})
+	c := New(s.addr(), WithUID("1"), WithToken("1234"), WithRateLimit(20, 3), WithReconnectPolicy(&ReconnectPolicy{
+		InitialDelay: time.Millisecond * 10,
+		Multiplier:   1,
+		MaxDelay:     time.Millisecond * 10,
+	}))
+	err := c.Connect()
+	assert.NoError(t, err)
+	defer c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+	conn := <-s.conns
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, c.SendMessage(NewChannel("group", 2), []byte("hello"), WithMessageAckTimeout(0)))
+	}
+	// 令牌用完后断开，重连后发件箱里的消息按限速重发
+	acking.Store(true)
+	start := time.Now()
+	conn.Close()
+	var last time.Time
+	for i := 0; i < 3; i++ {
+		last = <-sent
+	}
+	assert.True(t, last.Sub(start) >= time.Millisecond*100, "resent in %v", last.Sub(start))
+	assert.Eventually(t, func() bool {
+		return c.Stats().OutboxPending == 0
+	}, time.Second, time.Millisecond*10)
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+)
+
+// 批量回执，攒够size个回执或第一个回执等待了delay后一起发送
+type recvackBatcher struct {
+	size    int
+	delay   time.Duration
+	flush   func(packets []lmproto.Frame)
+	lock    sync.Mutex
+	pending []lmproto.Frame
+	timer   *time.Timer
+}
+
+func newRecvackBatcher(size int, delay time.Duration, flush func(packets []lmproto.Frame)) *recvackBatcher {
+	return &recvackBatcher{
+		size:  size,
+		delay: delay,
+		flush: flush,
+	}
+}
+
+func (b *recvackBatcher) add(packet *lmproto.RecvackPacket) {
+	b.lock.Lock()
+	b.pending = append(b.pending, packet)
+	if len(b.pending) >= b.size {
+		packets := b.takeLocked()
+		b.lock.Unlock()
+		b.flush(packets)
+		return
+	}
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.delay, func() {
+			if packets := b.take(); len(packets) > 0 {
+				b.flush(packets)
+			}
+		})
+	}
+	b.lock.Unlock()
+}
+
+// 取出攒着的回执
+func (b *recvackBatcher) take() []lmproto.Frame {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.takeLocked()
+}
+
+func (b *recvackBatcher) takeLocked() []lmproto.Frame {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	packets := b.pending
+	b.pending = nil
+	return packets
+}
+
+// 取出攒着的回执，没有开启批量回执时返回nil
+func (c *Client) takeRecvacks() []lmproto.Frame {
+	if c.recvacks == nil {
+		return nil
+	}
+	return c.recvacks.take()
+}
+
+// 在一次写入中发送攒着的回执，发送失败时服务端会重新投递消息
+func (c *Client) flushRecvacks(packets []lmproto.Frame) {
+	if err := c.sendPacketsContext(context.Background(), packets...); err != nil {
+		c.logger.Warn("批量发送消息回执失败！", "count", len(packets), "error", err)
+	}
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecvackBatch(t *testing.T) {
+	s := newTestServer(t, nil)
+	c := New(s.addr(), WithUID("1"), WithToken("1234"), WithRecvackBatch(3, time.Millisecond*100))
+	err := c.Connect()
+	assert.NoError(t, err)
+	<-s.frames // CONNECT
+	conn := <-s.conns
+	recv := func(messageIDs ...int64) {
+		for _, messageID := range messageIDs {
+			s.write(conn, &lmproto.RecvPacket{MessageID: messageID, MessageSeq: uint32(messageID), ChannelID: "test", ChannelType: 1})
+		}
+	}
+	expectRecvacks := func(messageIDs ...int64) {
+		for _, messageID := range messageIDs {
+			frame := <-s.frames
+			assert.Equal(t, messageID, frame.(*lmproto.RecvackPacket).MessageID)
+		}
+	}
+
+	// 攒够数量后立即发送
+	recv(1, 2, 3)
+	expectRecvacks(1, 2, 3)
+
+	// 不够数量时等待一段时间后发送
+	start := time.Now()
+	recv(4)
+	expectRecvacks(4)
+	assert.True(t, time.Since(start) >= time.Millisecond*100)
+
+	// 断开连接时和断开包一起发送
+	recv(5, 6)
+	time.Sleep(time.Millisecond * 20)
+	err = c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+	assert.NoError(t, err)
+	expectRecvacks(5, 6)
+	frame := <-s.frames
+	assert.Equal(t, lmproto.DISCONNECT, frame.GetPacketType())
+}
+
+func TestRecvackBatchPing(t *testing.T) {
+	s := newTestServer(t, nil)
+	c := New(s.addr(), WithUID("1"), WithToken("1234"), WithRecvackBatch(100, time.Hour),
+		WithHeartbeat(time.Millisecond*100, time.Second, 3))
+	err := c.Connect()
+	assert.NoError(t, err)
+	defer c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+	<-s.frames // CONNECT
+	conn := <-s.conns
+
+	s.write(conn, &lmproto.RecvPacket{MessageID: 1, MessageSeq: 1, ChannelID: "test", ChannelType: 1})
+	// 发送ping时带上攒着的回执
+	frame := <-s.frames
+	assert.Equal(t, int64(1), frame.(*lmproto.RecvackPacket).MessageID)
+	frame = <-s.frames
+	assert.Equal(t, lmproto.PING, frame.GetPacketType())
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+)
+
+// 等待回执的消息的重发状态
+type retransmit struct {
+	packet  *lmproto.SendPacket
+	opts    *SendOptions
+	retries int // 已重发次数
+	timer   *time.Timer
+}
+
+// 开始等待发送回执，超时后重发
+func (c *Client) startRetransmit(packet *lmproto.SendPacket, opts *SendOptions) {
+	if opts.AckTimeout <= 0 {
+		return
+	}
+	r := &retransmit{
+		packet: packet,
+		opts:   opts,
+	}
+	c.retransmitsLock.Lock()
+	c.retransmits[packet.ClientSeq] = r
+	r.timer = time.AfterFunc(opts.AckTimeout, func() {
+		c.handleAckTimeout(packet.ClientSeq)
+	})
+	c.retransmitsLock.Unlock()
+}
+
+// 连接后重发发件箱里的消息时，为没有重发状态的消息(上次进程退出前没发送成功的)开始等待回执，返回消息的发送配置
+func (c *Client) ensureRetransmit(packet *lmproto.SendPacket) *SendOptions {
+	c.retransmitsLock.Lock()
+	r, ok := c.retransmits[packet.ClientSeq]
+	c.retransmitsLock.Unlock()
+	if ok {
+		return r.opts
+	}
+	opts := newSendOptions(c.opts)
+	c.startRetransmit(packet, opts)
+	return opts
+}
+
+// 停止等待发送回执
+func (c *Client) stopRetransmit(clientSeq uint64) {
+	c.retransmitsLock.Lock()
+	defer c.retransmitsLock.Unlock()
+	if r := c.retransmits[clientSeq]; r != nil {
+		r.timer.Stop()
+		delete(c.retransmits, clientSeq)
+	}
+}
+
+// 客户端关闭时停止所有重发
+func (c *Client) stopAllRetransmits() {
+	c.retransmitsLock.Lock()
+	defer c.retransmitsLock.Unlock()
+	for clientSeq, r := range c.retransmits {
+		r.timer.Stop()
+		delete(c.retransmits, clientSeq)
+	}
+}
+
+// 等待发送回执超时，重发或者放弃
+func (c *Client) handleAckTimeout(clientSeq uint64) {
+	c.retransmitsLock.Lock()
+	r := c.retransmits[clientSeq]
+	if r == nil { // 已收到回执
+		c.retransmitsLock.Unlock()
+		return
+	}
+	if r.retries >= r.opts.MaxRetries {
+		delete(c.retransmits, clientSeq)
+		c.retransmitsLock.Unlock()
+
+		c.logger.Warn("消息重发次数用完，发送失败！", "clientSeq", r.packet.ClientSeq, "clientMsgNo", r.packet.ClientMsgNo)
+		c.removeSending(clientSeq)
+		c.rejectSendack(clientSeq, ErrAckTimeout)
+		if c.onSendFailed != nil {
+			c.onSendFailed(r.packet, ErrAckTimeout)
+		}
+		return
+	}
+	if c.State() != StateConnected { // 断开期间不消耗重发次数，重连后会重发发件箱里的消息
+		r.timer.Reset(r.opts.AckTimeout)
+		c.retransmitsLock.Unlock()
+		return
+	}
+	retries := r.retries + 1
+	c.retransmitsLock.Unlock()
+
+	c.logger.Debug("等待发送回执超时，重发消息", "clientSeq", clientSeq, "retries", retries)
+	err := c.resendPacket(r.packet, r.opts.Priority)
+	c.retransmitsLock.Lock()
+	defer c.retransmitsLock.Unlock()
+	if c.retransmits[clientSeq] != r { // 重发时收到了回执
+		return
+	}
+	if err == nil { // 只有写入了连接才算一次重发
+		r.retries = retries
+	}
+	r.timer.Reset(r.opts.AckTimeout)
+}
+
+// 重发消息，设置DUP标记让服务端根据ClientMsgNo去重
+func (c *Client) resendPacket(packet *lmproto.SendPacket, priority Priority) error {
+	if err := c.waitResend(packet); err != nil {
+		return err
+	}
+	dup := *packet
+	dup.DUP = true
+	return c.sendPacketsPriority(context.Background(), priority, &dup)
+}
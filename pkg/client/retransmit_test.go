@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
+)
+
+func TestRetransmit(t *testing.T) {
+	dups := make(chan bool, 10)
+	s := newTestServer(t, func(s *testServer, conn net.Conn, frame lmproto.Frame) {
+		if packet, ok := frame.(*lmproto.SendPacket); ok {
+			dups <- packet.DUP
+			if len(dups) < 3 { // 前两次不回执
+				return
+			}
+		}
+		defaultTestHandler(s, conn, frame)
+	})
+	c := New(s.addr(), WithUID("1"), WithToken("1234"))
+	err := c.Connect()
+	assert.NoError(t, err)
+	defer c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+
+	sendack, err := c.SendMessageWait(context.Background(), NewChannel("test", 1), []byte("hello"), WithMessageAckTimeout(time.Millisecond*50), WithMessageMaxRetries(3))
+	assert.NoError(t, err)
+	assert.Equal(t, lmproto.ReasonSuccess, sendack.ReasonCode)
+	assert.Equal(t, false, <-dups)
+	assert.Equal(t, true, <-dups)
+	assert.Equal(t, true, <-dups)
+}
+
+func TestRetransmitFailed(t *testing.T) {
+	// 服务端不回发送回执
+	s := newTestServer(t, func(s *testServer, conn net.Conn, frame lmproto.Frame) {
+		if frame.GetPacketType() != lmproto.SEND {
+			defaultTestHandler(s, conn, frame)
+		}
+	})
+	c := New(s.addr(), WithUID("1"), WithToken("1234"))
+	failed := make(chan error, 1)
+	c.SetOnSendFailed(func(packet *lmproto.SendPacket, err error) {
+		failed <- err
+	})
+	err := c.Connect()
+	assert.NoError(t, err)
+
+	_, err = c.SendMessageWait(context.Background(), NewChannel("test", 1), []byte("hello"), WithMessageAckTimeout(time.Millisecond*20), WithMessageMaxRetries(1))
+	assert.Equal(t, ErrAckTimeout, err)
+	assert.Equal(t, ErrAckTimeout, <-failed)
+
+	// 发送失败的消息不再等待回执，可以立即断开
+	err = c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+	assert.NoError(t, err)
+}
+
+func TestRetransmitWhileDisconnected(t *testing.T) {
+	var acking atomic.Bool
+	sent := make(chan struct{}, 10)
+	s := newTestServer(t, func(s *testServer, conn net.Conn, frame lmproto.Frame) {
+		if frame.GetPacketType() == lmproto.SEND {
+			sent <- struct{}{}
+			if !acking.Load() {
+				return
+			}
+		}
+		defaultTestHandler(s, conn, frame)
+	})
+	c := New(s.addr(), WithUID("1"), WithToken("1234"), WithReconnectPolicy(&ReconnectPolicy{
+		InitialDelay: time.Millisecond * 200,
+		Multiplier:   1,
+		MaxDelay:     time.Millisecond * 200,
+	}))
+	failed := make(chan error, 1)
+	c.SetOnSendFailed(func(packet *lmproto.SendPacket, err error) {
+		failed <- err
+	})
+	err := c.Connect()
+	assert.NoError(t, err)
+	defer c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+	conn := <-s.conns
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := c.SendMessageWait(context.Background(), NewChannel("test", 1), []byte("hello"), WithMessageAckTimeout(time.Millisecond*20), WithMessageMaxRetries(1))
+		result <- err
+	}()
+	<-sent
+	// 断开的时间超过AckTimeout*(MaxRetries+1)，重连后消息仍然重发
+	acking.Store(true)
+	conn.Close()
+	assert.NoError(t, <-result)
+	select {
+	case err := <-failed:
+		t.Fatalf("unexpected send failure: %v", err)
+	default:
+	}
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+)
+
+// testHandler 测试服务端的包处理函数
+type testHandler func(s *testServer, conn net.Conn, frame lmproto.Frame)
+
+// testServer 测试用的狸猫IM服务端
+type testServer struct {
+	t       *testing.T
+	ln      net.Listener
+	proto   *lmproto.LiMaoProto
+	handler testHandler
+	frames  chan lmproto.Frame // 服务端收到的包
+	conns   chan net.Conn      // 新建立的连接
+	wg      sync.WaitGroup
+}
+
+// newTestServer 启动测试服务端，handler为nil时使用defaultTestHandler
+func newTestServer(t *testing.T, handler testHandler) *testServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handler == nil {
+		handler = defaultTestHandler
+	}
+	s := &testServer{
+		t:       t,
+		ln:      ln,
+		proto:   lmproto.New(),
+		handler: handler,
+		frames:  make(chan lmproto.Frame, 1024),
+		conns:   make(chan net.Conn, 256),
+	}
+	s.wg.Add(1)
+	go s.loopAccept()
+	t.Cleanup(s.close)
+	return s
+}
+
+// addr 客户端连接地址
+func (s *testServer) addr() string {
+	return "tcp://" + s.ln.Addr().String()
+}
+
+func (s *testServer) close() {
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+func (s *testServer) loopAccept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.serve(conn)
+	}
+}
+
+// serve 处理一个连接，用于net.Pipe等不经过监听的连接
+func (s *testServer) serve(conn net.Conn) {
+	s.conns <- conn
+	go s.loopConn(conn)
+}
+
+func (s *testServer) loopConn(conn net.Conn) {
+	defer conn.Close()
+	for {
+		frame, err := s.proto.DecodePacketWithConn(conn, lmproto.LatestVersion)
+		if err != nil {
+			return
+		}
+		s.frames <- frame
+		s.handler(s, conn, frame)
+	}
+}
+
+// write 向客户端写入包
+func (s *testServer) write(conn net.Conn, frame lmproto.Frame) {
+	data, err := s.proto.EncodePacket(frame, lmproto.LatestVersion)
+	if err != nil {
+		s.t.Error(err)
+		return
+	}
+	conn.Write(data)
+}
+
+// defaultTestHandler 回应连接、发送和ping
+func defaultTestHandler(s *testServer, conn net.Conn, frame lmproto.Frame) {
+	switch packet := frame.(type) {
+	case *lmproto.ConnectPacket:
+		s.write(conn, &lmproto.ConnackPacket{ReasonCode: lmproto.ReasonSuccess})
+	case *lmproto.SendPacket:
+		s.write(conn, &lmproto.SendackPacket{
+			ClientSeq:  packet.ClientSeq,
+			MessageID:  int64(packet.ClientSeq),
+			ReasonCode: lmproto.ReasonSuccess,
+		})
+	case *lmproto.PingPacket:
+		s.write(conn, &lmproto.PongPacket{})
+	}
+}
@@ -0,0 +1,112 @@
+package client
+
+import "fmt"
+
+// State 连接状态
+type State int32
+
+const (
+	// StateIdle 未连接
+	StateIdle State = iota
+	// StateDialing 拨号中
+	StateDialing
+	// StateHandshaking 握手中(已发送连接包，等待连接回执)
+	StateHandshaking
+	// StateConnected 已连接
+	StateConnected
+	// StateReconnecting 连接断开，等待重连
+	StateReconnecting
+	// StateClosed 已关闭，不会再连接
+	StateClosed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateIdle:
+		return "Idle"
+	case StateDialing:
+		return "Dialing"
+	case StateHandshaking:
+		return "Handshaking"
+	case StateConnected:
+		return "Connected"
+	case StateReconnecting:
+		return "Reconnecting"
+	case StateClosed:
+		return "Closed"
+	}
+	return fmt.Sprintf("State(%d)", int32(s))
+}
+
+// 合法的状态切换
+var stateTransitions = map[State][]State{
+	StateIdle:         {StateDialing, StateClosed},
+	StateDialing:      {StateHandshaking, StateIdle, StateReconnecting, StateClosed},
+	StateHandshaking:  {StateConnected, StateIdle, StateReconnecting, StateClosed},
+	StateConnected:    {StateIdle, StateReconnecting, StateClosed},
+	StateReconnecting: {StateDialing, StateClosed},
+	StateClosed:       {},
+}
+
+// canTransition 是否可以从from状态切换到to状态
+func canTransition(from, to State) bool {
+	for _, state := range stateTransitions[from] {
+		if state == to {
+			return true
+		}
+	}
+	return false
+}
+
+// StateTransitionError 非法的状态切换
+type StateTransitionError struct {
+	From State
+	To   State
+}
+
+func (e *StateTransitionError) Error() string {
+	return fmt.Sprintf("不能从[%s]状态切换到[%s]状态！", e.From, e.To)
+}
+
+// OnStateChange 连接状态变化事件，cause为引起变化的原因，主动操作时为nil
+type OnStateChange func(prev State, next State, cause error)
+
+// State 当前连接状态
+func (c *Client) State() State {
+	return State(c.state.Load())
+}
+
+// SetOnStateChange 设置连接状态变化事件
+func (c *Client) SetOnStateChange(onStateChange OnStateChange) {
+	c.onStateChange = onStateChange
+}
+
+// 切换状态，非法切换时返回*StateTransitionError
+func (c *Client) setState(next State, cause error) error {
+	return c.changeState(next, cause, nil)
+}
+
+// 切换状态，切换成功时在同一个临界区里调用onChange(可以为nil)
+func (c *Client) changeState(next State, cause error, onChange func()) error {
+	c.stateLock.Lock()
+	prev := c.State()
+	if !canTransition(prev, next) {
+		c.stateLock.Unlock()
+		return &StateTransitionError{From: prev, To: next}
+	}
+	c.state.Store(int32(next))
+	if onChange != nil {
+		onChange()
+	}
+	c.stateLock.Unlock()
+
+	if cause != nil {
+		c.logger.Info("连接状态变化", "from", prev, "to", next, "cause", cause)
+	} else {
+		c.logger.Info("连接状态变化", "from", prev, "to", next)
+	}
+	if c.onStateChange != nil {
+		c.onStateChange(prev, next, cause)
+	}
+	return nil
+}
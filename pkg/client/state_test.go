@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateTransition(t *testing.T) {
+	assert.True(t, canTransition(StateIdle, StateDialing))
+	assert.True(t, canTransition(StateConnected, StateReconnecting))
+	assert.False(t, canTransition(StateIdle, StateConnected))
+	assert.False(t, canTransition(StateClosed, StateDialing))
+
+	c := New("tcp://127.0.0.1:0")
+	err := c.setState(StateConnected, nil)
+	assert.Equal(t, &StateTransitionError{From: StateIdle, To: StateConnected}, err)
+	assert.Equal(t, StateIdle, c.State())
+}
+
+func TestOnStateChange(t *testing.T) {
+	s := newTestServer(t, nil)
+	c := New(s.addr(), WithUID("1"), WithToken("1234"), WithoutReconnect())
+
+	var lock sync.Mutex
+	states := make([]State, 0)
+	causes := make([]error, 0)
+	c.SetOnStateChange(func(prev, next State, cause error) {
+		lock.Lock()
+		defer lock.Unlock()
+		states = append(states, next)
+		causes = append(causes, cause)
+	})
+	err := c.Connect()
+	assert.NoError(t, err)
+	assert.Equal(t, StateConnected, c.State())
+
+	// 服务端断开连接
+	(<-s.conns).Close()
+	assert.Eventually(t, func() bool {
+		return c.State() == StateIdle
+	}, time.Second, time.Millisecond*10)
+
+	c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+	assert.Equal(t, StateClosed, c.State())
+	assert.Equal(t, ErrClosed, c.Connect())
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, []State{StateDialing, StateHandshaking, StateConnected, StateIdle, StateClosed}, states)
+	assert.Error(t, causes[3])
+}
@@ -0,0 +1,407 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+	"go.uber.org/atomic"
+)
+
+// 发送回执延迟和限速等待时间直方图的桶上限
+var latencyBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// PacketStats 某种包的收发统计
+type PacketStats struct {
+	Frames int64 // 包数
+	Bytes  int64 // 字节数
+}
+
+// HistogramBucket 直方图的桶，Count为小于等于UpperBound的累计次数
+type HistogramBucket struct {
+	UpperBound time.Duration
+	Count      int64
+}
+
+// Histogram 延迟直方图
+type Histogram struct {
+	Buckets []HistogramBucket
+	Count   int64         // 总次数
+	Sum     time.Duration // 总延迟
+}
+
+// Stats 客户端统计快照
+type Stats struct {
+	Sent              map[lmproto.PacketType]PacketStats // 发送的包，按包类型统计
+	Received          map[lmproto.PacketType]PacketStats // 收到的包，按包类型统计
+	Reconnects        int64                              // 重连成功次数
+	ReconnectAttempts int64                              // 尝试重连次数
+	OutboxPending     int                                // 发件箱里等待回执的消息数
+	SendackLatency    Histogram                          // 从第一次发送消息到收到回执的延迟
+	SendackReasons    map[lmproto.ReasonCode]int64       // 发送回执按原因码统计
+	MessagesDropped   int64                              // Messages()缓冲满时丢弃的消息数
+	AcksDropped       int64                              // Acks()缓冲满时丢弃的回执数
+	Duplicates        int64                              // 去重窗口丢弃的重复消息数
+	Gaps              int64                              // 有序投递时跳过的序号缺失次数
+	RecvQueued        int                                // 处理队列里等待的消息数
+	RecvQueueWait     Histogram                          // 收到的消息在处理队列里等待的时间(开启了WithRecvWorkers时)
+	RateLimitWait     Histogram                          // 发送消息时等待限速的时间(开启了限速时)
+	RateLimited       int64                              // 超过限速立即失败的消息数
+}
+
+// 处理队列等待时间直方图的默认桶上限
+var defaultRecvQueueWaitBuckets = []time.Duration{
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// 包类型数量上限，包类型只有4位
+const maxPacketType = 16
+
+// 客户端的统计数据
+type clientStats struct {
+	sentFrames        [maxPacketType]atomic.Int64
+	sentBytes         [maxPacketType]atomic.Int64
+	receivedFrames    [maxPacketType]atomic.Int64
+	receivedBytes     [maxPacketType]atomic.Int64
+	reconnects        atomic.Int64
+	reconnectAttempts atomic.Int64
+	duplicates        atomic.Int64
+	gaps              atomic.Int64
+
+	sendackLatency     *histogram
+	sendackReasonsLock sync.Mutex
+	sendackReasons     map[lmproto.ReasonCode]int64
+	recvQueueWait      *histogram // 收到的消息在处理队列里等待的时间
+	rateLimitWait      *histogram // 发送消息时等待限速的时间
+	rateLimited        atomic.Int64
+	sentAtLock         sync.Mutex
+	sentAt             map[uint64]time.Time // 等待回执的消息第一次发送的时间，key为ClientSeq
+}
+
+func newClientStats(recvQueueWaitBuckets []time.Duration) *clientStats {
+	return &clientStats{
+		sendackLatency: newHistogram(latencyBuckets),
+		sendackReasons: make(map[lmproto.ReasonCode]int64),
+		recvQueueWait:  newHistogram(recvQueueWaitBuckets),
+		rateLimitWait:  newHistogram(latencyBuckets),
+		sentAt:         make(map[uint64]time.Time),
+	}
+}
+
+// 记录消息第一次发送的时间，重发时不覆盖
+func (s *clientStats) markSent(clientSeq uint64) {
+	s.sentAtLock.Lock()
+	defer s.sentAtLock.Unlock()
+	if _, ok := s.sentAt[clientSeq]; !ok {
+		s.sentAt[clientSeq] = time.Now()
+	}
+}
+
+// 取出消息第一次发送的时间
+func (s *clientStats) takeSentAt(clientSeq uint64) (time.Time, bool) {
+	s.sentAtLock.Lock()
+	defer s.sentAtLock.Unlock()
+	sentAt, ok := s.sentAt[clientSeq]
+	delete(s.sentAt, clientSeq)
+	return sentAt, ok
+}
+
+func (s *clientStats) addSent(packetType lmproto.PacketType, bytes int) {
+	if packetType < maxPacketType {
+		s.sentFrames[packetType].Inc()
+		s.sentBytes[packetType].Add(int64(bytes))
+	}
+}
+
+func (s *clientStats) addReceived(packetType lmproto.PacketType, bytes int) {
+	if packetType < maxPacketType {
+		s.receivedFrames[packetType].Inc()
+		s.receivedBytes[packetType].Add(int64(bytes))
+	}
+}
+
+// 记录一个发送回执，latency小于0表示没有发送时间
+func (s *clientStats) addSendack(reasonCode lmproto.ReasonCode, latency time.Duration) {
+	s.sendackReasonsLock.Lock()
+	s.sendackReasons[reasonCode]++
+	s.sendackReasonsLock.Unlock()
+	if latency >= 0 {
+		s.sendackLatency.observe(latency)
+	}
+}
+
+func (s *clientStats) snapshot() Stats {
+	stats := Stats{
+		Sent:              make(map[lmproto.PacketType]PacketStats),
+		Received:          make(map[lmproto.PacketType]PacketStats),
+		Reconnects:        s.reconnects.Load(),
+		ReconnectAttempts: s.reconnectAttempts.Load(),
+		Duplicates:        s.duplicates.Load(),
+		Gaps:              s.gaps.Load(),
+		SendackReasons:    make(map[lmproto.ReasonCode]int64),
+	}
+	for i := 0; i < maxPacketType; i++ {
+		if frames := s.sentFrames[i].Load(); frames > 0 {
+			stats.Sent[lmproto.PacketType(i)] = PacketStats{Frames: frames, Bytes: s.sentBytes[i].Load()}
+		}
+		if frames := s.receivedFrames[i].Load(); frames > 0 {
+			stats.Received[lmproto.PacketType(i)] = PacketStats{Frames: frames, Bytes: s.receivedBytes[i].Load()}
+		}
+	}
+
+	s.sendackReasonsLock.Lock()
+	for reasonCode, count := range s.sendackReasons {
+		stats.SendackReasons[reasonCode] = count
+	}
+	s.sendackReasonsLock.Unlock()
+	stats.SendackLatency = s.sendackLatency.snapshot()
+	stats.RecvQueueWait = s.recvQueueWait.snapshot()
+	stats.RateLimitWait = s.rateLimitWait.snapshot()
+	stats.RateLimited = s.rateLimited.Load()
+	return stats
+}
+
+// 延迟直方图
+type histogram struct {
+	lock   sync.Mutex
+	bounds []time.Duration // 桶上限，从小到大
+	counts []int64         // 每个桶的次数(非累计)
+	count  int64
+	sum    time.Duration
+}
+
+func newHistogram(bounds []time.Duration) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]int64, len(bounds)),
+	}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.count++
+	h.sum += d
+	for i, upperBound := range h.bounds {
+		if d <= upperBound {
+			h.counts[i]++
+			break
+		}
+	}
+}
+
+func (h *histogram) snapshot() Histogram {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	snapshot := Histogram{
+		Buckets: make([]HistogramBucket, len(h.bounds)),
+		Count:   h.count,
+		Sum:     h.sum,
+	}
+	var cumulative int64
+	for i, upperBound := range h.bounds {
+		cumulative += h.counts[i]
+		snapshot.Buckets[i] = HistogramBucket{UpperBound: upperBound, Count: cumulative}
+	}
+	return snapshot
+}
+
+// Stats 获取客户端统计快照
+func (c *Client) Stats() Stats {
+	stats := c.stats.snapshot()
+	stats.OutboxPending = c.outbox.Len()
+	stats.MessagesDropped = c.messages.dropped.Load()
+	stats.AcksDropped = c.acks.dropped.Load()
+	if c.workers != nil {
+		stats.RecvQueued = c.workers.queued()
+	}
+	return stats
+}
+
+// 统计读取的字节数
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += n
+	return n, err
+}
+
+// MetricsHandler 以Prometheus文本格式输出客户端的统计
+func (c *Client) MetricsHandler() http.Handler {
+	return metricsHandler(func() []*Client {
+		return []*Client{c}
+	})
+}
+
+// MetricsHandler 以Prometheus文本格式输出所有客户端的统计，用uid标签区分
+func (m *ClientManager) MetricsHandler() http.Handler {
+	return metricsHandler(m.Clients)
+}
+
+func metricsHandler(clients func() []*Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, clients())
+	})
+}
+
+// 客户端的统计快照
+type clientSnapshot struct {
+	uid   string
+	stats Stats
+}
+
+// writeMetrics 以Prometheus文本格式写入统计，同一指标的所有样本写在一起
+func writeMetrics(w io.Writer, clients []*Client) {
+	snapshots := make([]clientSnapshot, 0, len(clients))
+	for _, c := range clients {
+		snapshots = append(snapshots, clientSnapshot{uid: c.UID(), stats: c.Stats()})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].uid < snapshots[j].uid
+	})
+
+	writePacketMetrics := func(name, help string, packets func(Stats) map[lmproto.PacketType]PacketStats, value func(PacketStats) int64) {
+		writeMetricHeader(w, name, help, "counter")
+		for _, s := range snapshots {
+			stats := packets(s.stats)
+			for _, packetType := range sortedPacketTypes(stats) {
+				fmt.Fprintf(w, "%s{uid=%s,type=%s} %d\n", name, quoteLabel(s.uid), quoteLabel(packetType.String()), value(stats[packetType]))
+			}
+		}
+	}
+	sent := func(stats Stats) map[lmproto.PacketType]PacketStats { return stats.Sent }
+	received := func(stats Stats) map[lmproto.PacketType]PacketStats { return stats.Received }
+	frames := func(p PacketStats) int64 { return p.Frames }
+	bytes := func(p PacketStats) int64 { return p.Bytes }
+	writePacketMetrics("limao_client_sent_frames_total", "发送的包数", sent, frames)
+	writePacketMetrics("limao_client_sent_bytes_total", "发送的字节数", sent, bytes)
+	writePacketMetrics("limao_client_received_frames_total", "收到的包数", received, frames)
+	writePacketMetrics("limao_client_received_bytes_total", "收到的字节数", received, bytes)
+
+	writeMetricHeader(w, "limao_client_reconnects_total", "重连成功次数", "counter")
+	for _, s := range snapshots {
+		fmt.Fprintf(w, "limao_client_reconnects_total{uid=%s} %d\n", quoteLabel(s.uid), s.stats.Reconnects)
+	}
+	writeMetricHeader(w, "limao_client_reconnect_attempts_total", "尝试重连次数", "counter")
+	for _, s := range snapshots {
+		fmt.Fprintf(w, "limao_client_reconnect_attempts_total{uid=%s} %d\n", quoteLabel(s.uid), s.stats.ReconnectAttempts)
+	}
+	writeMetricHeader(w, "limao_client_outbox_pending", "发件箱里等待回执的消息数", "gauge")
+	for _, s := range snapshots {
+		fmt.Fprintf(w, "limao_client_outbox_pending{uid=%s} %d\n", quoteLabel(s.uid), s.stats.OutboxPending)
+	}
+
+	writeMetricHeader(w, "limao_client_stream_dropped_total", "消息流缓冲满时丢弃的数量", "counter")
+	for _, s := range snapshots {
+		fmt.Fprintf(w, "limao_client_stream_dropped_total{uid=%s,stream=\"messages\"} %d\n", quoteLabel(s.uid), s.stats.MessagesDropped)
+		fmt.Fprintf(w, "limao_client_stream_dropped_total{uid=%s,stream=\"acks\"} %d\n", quoteLabel(s.uid), s.stats.AcksDropped)
+	}
+
+	writeMetricHeader(w, "limao_client_recv_duplicates_total", "去重窗口丢弃的重复消息数", "counter")
+	for _, s := range snapshots {
+		fmt.Fprintf(w, "limao_client_recv_duplicates_total{uid=%s} %d\n", quoteLabel(s.uid), s.stats.Duplicates)
+	}
+
+	writeMetricHeader(w, "limao_client_recv_gaps_total", "有序投递时跳过的序号缺失次数", "counter")
+	for _, s := range snapshots {
+		fmt.Fprintf(w, "limao_client_recv_gaps_total{uid=%s} %d\n", quoteLabel(s.uid), s.stats.Gaps)
+	}
+
+	writeHistogramMetrics := func(name, help string, histogram func(Stats) Histogram) {
+		writeMetricHeader(w, name, help, "histogram")
+		for _, s := range snapshots {
+			uid := quoteLabel(s.uid)
+			h := histogram(s.stats)
+			for _, bucket := range h.Buckets {
+				fmt.Fprintf(w, "%s_bucket{uid=%s,le=\"%g\"} %d\n", name, uid, bucket.UpperBound.Seconds(), bucket.Count)
+			}
+			fmt.Fprintf(w, "%s_bucket{uid=%s,le=\"+Inf\"} %d\n", name, uid, h.Count)
+			fmt.Fprintf(w, "%s_sum{uid=%s} %g\n", name, uid, h.Sum.Seconds())
+			fmt.Fprintf(w, "%s_count{uid=%s} %d\n", name, uid, h.Count)
+		}
+	}
+	writeHistogramMetrics("limao_client_sendack_latency_seconds", "从发送消息到收到回执的延迟", func(stats Stats) Histogram {
+		return stats.SendackLatency
+	})
+	writeHistogramMetrics("limao_client_recv_queue_wait_seconds", "收到的消息在处理队列里等待的时间", func(stats Stats) Histogram {
+		return stats.RecvQueueWait
+	})
+	writeHistogramMetrics("limao_client_rate_limit_wait_seconds", "发送消息时等待限速的时间", func(stats Stats) Histogram {
+		return stats.RateLimitWait
+	})
+	writeMetricHeader(w, "limao_client_rate_limited_total", "超过限速立即失败的消息数", "counter")
+	for _, s := range snapshots {
+		fmt.Fprintf(w, "limao_client_rate_limited_total{uid=%s} %d\n", quoteLabel(s.uid), s.stats.RateLimited)
+	}
+	writeMetricHeader(w, "limao_client_recv_queue_length", "处理队列里等待的消息数", "gauge")
+	for _, s := range snapshots {
+		fmt.Fprintf(w, "limao_client_recv_queue_length{uid=%s} %d\n", quoteLabel(s.uid), s.stats.RecvQueued)
+	}
+
+	writeMetricHeader(w, "limao_client_sendacks_total", "收到的发送回执数，按原因码统计", "counter")
+	for _, s := range snapshots {
+		reasonCodes := make([]lmproto.ReasonCode, 0, len(s.stats.SendackReasons))
+		for reasonCode := range s.stats.SendackReasons {
+			reasonCodes = append(reasonCodes, reasonCode)
+		}
+		sort.Slice(reasonCodes, func(i, j int) bool {
+			return reasonCodes[i] < reasonCodes[j]
+		})
+		for _, reasonCode := range reasonCodes {
+			fmt.Fprintf(w, "limao_client_sendacks_total{uid=%s,reason_code=\"%d\"} %d\n", quoteLabel(s.uid), reasonCode, s.stats.SendackReasons[reasonCode])
+		}
+	}
+}
+
+func writeMetricHeader(w io.Writer, name, help, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+func sortedPacketTypes(packets map[lmproto.PacketType]PacketStats) []lmproto.PacketType {
+	packetTypes := make([]lmproto.PacketType, 0, len(packets))
+	for packetType := range packets {
+		packetTypes = append(packetTypes, packetType)
+	}
+	sort.Slice(packetTypes, func(i, j int) bool {
+		return packetTypes[i] < packetTypes[j]
+	})
+	return packetTypes
+}
+
+// 转义Prometheus标签值
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(value string) string {
+	return `"` + labelReplacer.Replace(value) + `"`
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	s := newTestServer(t, func(s *testServer, conn net.Conn, frame lmproto.Frame) {
+		if packet, ok := frame.(*lmproto.SendPacket); ok && packet.ChannelID == "blacklist" {
+			s.write(conn, &lmproto.SendackPacket{
+				ClientSeq:  packet.ClientSeq,
+				ReasonCode: lmproto.ReasonInBlacklist,
+			})
+			return
+		}
+		defaultTestHandler(s, conn, frame)
+	})
+	c := New(s.addr(), WithUID("1"), WithToken("1234"))
+	err := c.Connect()
+	assert.NoError(t, err)
+	defer c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+
+	_, err = c.SendMessageWait(context.Background(), NewChannel("test", 1), []byte("hello"))
+	assert.NoError(t, err)
+	_, err = c.SendMessageWait(context.Background(), NewChannel("blacklist", 1), []byte("hello"))
+	assert.Error(t, err)
+
+	stats := c.Stats()
+	assert.Equal(t, int64(1), stats.Sent[lmproto.CONNECT].Frames)
+	assert.Equal(t, int64(2), stats.Sent[lmproto.SEND].Frames)
+	assert.NotZero(t, stats.Sent[lmproto.SEND].Bytes)
+	assert.Equal(t, int64(1), stats.Received[lmproto.CONNACK].Frames)
+	assert.Equal(t, int64(2), stats.Received[lmproto.SENDACK].Frames)
+	assert.NotZero(t, stats.Received[lmproto.SENDACK].Bytes)
+	assert.Equal(t, c.GetSendMsgBytes(), stats.Sent[lmproto.CONNECT].Bytes+stats.Sent[lmproto.SEND].Bytes)
+	assert.Equal(t, int64(1), stats.SendackReasons[lmproto.ReasonSuccess])
+	assert.Equal(t, int64(1), stats.SendackReasons[lmproto.ReasonInBlacklist])
+	assert.Equal(t, int64(2), stats.SendackLatency.Count)
+	assert.Equal(t, int64(2), stats.SendackLatency.Buckets[len(stats.SendackLatency.Buckets)-1].Count)
+	assert.Equal(t, 0, stats.OutboxPending)
+
+	w := httptest.NewRecorder()
+	c.MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(w.Body)
+	assert.Contains(t, string(body), "# TYPE limao_client_sent_frames_total counter\n")
+	assert.Contains(t, string(body), `limao_client_sent_frames_total{uid="1",type="SEND"} 2`)
+	assert.Contains(t, string(body), `limao_client_sendacks_total{uid="1",reason_code="4"} 1`)
+	assert.Contains(t, string(body), `limao_client_sendack_latency_seconds_bucket{uid="1",le="+Inf"} 2`)
+	assert.Contains(t, string(body), `limao_client_outbox_pending{uid="1"} 0`)
+}
+
+func TestSendackLatencyWithoutRetransmit(t *testing.T) {
+	s := newTestServer(t, nil)
+	c := New(s.addr(), WithUID("1"), WithToken("1234"), WithAckTimeout(0))
+	err := c.Connect()
+	assert.NoError(t, err)
+	defer c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+
+	_, err = c.SendMessageWait(context.Background(), NewChannel("test", 1), []byte("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), c.Stats().SendackLatency.Count)
+}
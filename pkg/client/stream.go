@@ -0,0 +1,177 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+	"go.uber.org/atomic"
+)
+
+// BackpressurePolicy 消息流缓冲满时的处理策略
+type BackpressurePolicy int
+
+const (
+	// BackpressureBlock 阻塞读取循环直到有空位(会推迟心跳的处理)
+	BackpressureBlock BackpressurePolicy = iota
+	// BackpressureDropOldest 丢弃缓冲里最早的一个，缓冲大小为0时同BackpressureDropNewest
+	BackpressureDropOldest
+	// BackpressureDropNewest 丢弃新来的
+	BackpressureDropNewest
+)
+
+func (p BackpressurePolicy) String() string {
+	switch p {
+	case BackpressureBlock:
+		return "Block"
+	case BackpressureDropOldest:
+		return "DropOldest"
+	case BackpressureDropNewest:
+		return "DropNewest"
+	}
+	return fmt.Sprintf("BackpressurePolicy(%d)", int(p))
+}
+
+// 消息流的公共部分，第一次获取channel后才开始推送，客户端关闭时关闭channel
+type streamBase struct {
+	policy  BackpressurePolicy
+	done    <-chan struct{} // 客户端关闭
+	enabled atomic.Bool
+	lock    sync.Mutex
+	closed  bool
+	dropped atomic.Int64
+}
+
+// 按策略推送，trySend不阻塞地放入缓冲，dropOldest不阻塞地丢弃缓冲里最早的一个，send阻塞地放入直到客户端关闭
+func (s *streamBase) push(trySend func() bool, dropOldest func() bool, send func()) {
+	if !s.enabled.Load() {
+		return
+	}
+	s.lock.Lock() // 保证关闭channel后不再推送
+	defer s.lock.Unlock()
+	if s.closed {
+		return
+	}
+	switch s.policy {
+	case BackpressureDropOldest:
+		for !trySend() {
+			s.dropped.Inc()
+			if !dropOldest() { // 缓冲大小为0时没有可以丢弃的，丢弃新来的
+				return
+			}
+		}
+	case BackpressureDropNewest:
+		if !trySend() {
+			s.dropped.Inc()
+		}
+	default:
+		send()
+	}
+}
+
+// 关闭channel，只关闭一次
+func (s *streamBase) close(closeChan func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.closed {
+		s.closed = true
+		closeChan()
+	}
+}
+
+// 收到的消息流
+type messageStream struct {
+	streamBase
+	ch chan *lmproto.RecvPacket
+}
+
+func newMessageStream(bufferSize int, policy BackpressurePolicy, done <-chan struct{}) *messageStream {
+	return &messageStream{
+		streamBase: streamBase{policy: policy, done: done},
+		ch:         make(chan *lmproto.RecvPacket, bufferSize),
+	}
+}
+
+func (s *messageStream) push(packet *lmproto.RecvPacket) {
+	s.streamBase.push(func() bool {
+		select {
+		case s.ch <- packet:
+			return true
+		default:
+			return false
+		}
+	}, func() bool {
+		select {
+		case <-s.ch:
+			return true
+		default:
+			return false
+		}
+	}, func() {
+		select {
+		case s.ch <- packet:
+		case <-s.done:
+		}
+	})
+}
+
+func (s *messageStream) close() {
+	s.streamBase.close(func() {
+		close(s.ch)
+	})
+}
+
+// 发送回执流
+type ackStream struct {
+	streamBase
+	ch chan *lmproto.SendackPacket
+}
+
+func newAckStream(bufferSize int, policy BackpressurePolicy, done <-chan struct{}) *ackStream {
+	return &ackStream{
+		streamBase: streamBase{policy: policy, done: done},
+		ch:         make(chan *lmproto.SendackPacket, bufferSize),
+	}
+}
+
+func (s *ackStream) push(packet *lmproto.SendackPacket) {
+	s.streamBase.push(func() bool {
+		select {
+		case s.ch <- packet:
+			return true
+		default:
+			return false
+		}
+	}, func() bool {
+		select {
+		case <-s.ch:
+			return true
+		default:
+			return false
+		}
+	}, func() {
+		select {
+		case s.ch <- packet:
+		case <-s.done:
+		}
+	})
+}
+
+func (s *ackStream) close() {
+	s.streamBase.close(func() {
+		close(s.ch)
+	})
+}
+
+// Messages 收到的消息流，第一次调用后开始推送，客户端关闭后channel关闭
+// 消息放入缓冲后即回执(被策略丢弃的消息也会回执)，缓冲大小和满时的策略由WithStreamBuffer设置
+func (c *Client) Messages() <-chan *lmproto.RecvPacket {
+	c.messages.enabled.Store(true)
+	return c.messages.ch
+}
+
+// Acks 发送回执流，第一次调用后开始推送，客户端关闭后channel关闭
+func (c *Client) Acks() <-chan *lmproto.SendackPacket {
+	c.acks.enabled.Store(true)
+	return c.acks.ch
+}
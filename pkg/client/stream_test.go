@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessagesAndAcks(t *testing.T) {
+	s := newTestServer(t, nil)
+	c := New(s.addr(), WithUID("1"), WithToken("1234"))
+	messages := c.Messages()
+	acks := c.Acks()
+	err := c.Connect()
+	assert.NoError(t, err)
+	conn := <-s.conns
+
+	s.write(conn, &lmproto.RecvPacket{MessageID: 1, MessageSeq: 1, ChannelID: "test", ChannelType: 1})
+	packet := <-messages
+	assert.Equal(t, int64(1), packet.MessageID)
+
+	err = c.SendMessage(NewChannel("test", 1), []byte("hello"))
+	assert.NoError(t, err)
+	sendack := <-acks
+	assert.Equal(t, lmproto.ReasonSuccess, sendack.ReasonCode)
+
+	// 客户端关闭后channel关闭
+	c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+	_, ok := <-messages
+	assert.False(t, ok)
+	_, ok = <-acks
+	assert.False(t, ok)
+}
+
+func TestMessagesBackpressure(t *testing.T) {
+	for _, tt := range []struct {
+		policy  BackpressurePolicy
+		expect  []int64
+		dropped int64
+	}{
+		{policy: BackpressureDropOldest, expect: []int64{3, 4}, dropped: 2},
+		{policy: BackpressureDropNewest, expect: []int64{1, 2}, dropped: 2},
+		{policy: BackpressureBlock, expect: []int64{1, 2, 3, 4}, dropped: 0},
+	} {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			s := newTestServer(t, nil)
+			c := New(s.addr(), WithUID("1"), WithToken("1234"), WithStreamBuffer(2, tt.policy))
+			messages := c.Messages()
+			err := c.Connect()
+			assert.NoError(t, err)
+			defer c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+			<-s.frames // CONNECT
+			conn := <-s.conns
+
+			for i := int64(1); i <= 4; i++ {
+				s.write(conn, &lmproto.RecvPacket{MessageID: i, MessageSeq: uint32(i), ChannelID: "test", ChannelType: 1})
+			}
+			// 丢弃策略下读取循环不会阻塞，4条消息都会回执
+			if tt.policy != BackpressureBlock {
+				for i := 0; i < 4; i++ {
+					<-s.frames
+				}
+			} else {
+				time.Sleep(time.Millisecond * 50)
+			}
+			var got []int64
+			for range tt.expect {
+				got = append(got, (<-messages).MessageID)
+			}
+			assert.Equal(t, tt.expect, got)
+			assert.Equal(t, tt.dropped, c.Stats().MessagesDropped)
+		})
+	}
+}
+
+func TestStreamUnbuffered(t *testing.T) {
+	for _, policy := range []BackpressurePolicy{BackpressureDropOldest, BackpressureDropNewest} {
+		s := newMessageStream(0, policy, make(chan struct{}))
+		s.enabled.Store(true)
+		done := make(chan struct{})
+		go func() {
+			s.push(&lmproto.RecvPacket{MessageID: 1})
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("%s push blocked", policy)
+		}
+		assert.Equal(t, int64(1), s.dropped.Load())
+	}
+}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"sync"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+)
+
+const (
+	// AnyChannelID 订阅时作为ChannelID，匹配这个频道类型的所有频道
+	AnyChannelID = "*"
+	// AnyChannelType 订阅时作为ChannelType，匹配所有类型里这个ChannelID的频道(频道类型从1开始)
+	AnyChannelType uint8 = 0
+)
+
+// 订阅的频道
+type channelKey struct {
+	channelID   string
+	channelType uint8
+}
+
+// 一个订阅
+type subscription struct {
+	handler OnRecv
+}
+
+// 频道订阅表
+type subscriptions struct {
+	lock     sync.RWMutex
+	channels map[channelKey][]*subscription
+}
+
+func newSubscriptions() *subscriptions {
+	return &subscriptions{
+		channels: make(map[channelKey][]*subscription),
+	}
+}
+
+func (s *subscriptions) add(key channelKey, sub *subscription) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.channels[key] = append(s.channels[key], sub)
+}
+
+func (s *subscriptions) remove(key channelKey, sub *subscription) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	subs := s.channels[key]
+	for i, existing := range subs {
+		if existing == sub {
+			subs = append(subs[:i:i], subs[i+1:]...)
+			break
+		}
+	}
+	if len(subs) == 0 {
+		delete(s.channels, key)
+	} else {
+		s.channels[key] = subs
+	}
+}
+
+// 匹配频道的订阅，依次为精确匹配、通配ChannelID、通配ChannelType、全部通配，同一频道按订阅顺序
+func (s *subscriptions) match(channelID string, channelType uint8) []*subscription {
+	keys := [...]channelKey{
+		{channelID: channelID, channelType: channelType},
+		{channelID: AnyChannelID, channelType: channelType},
+		{channelID: channelID, channelType: AnyChannelType},
+		{channelID: AnyChannelID, channelType: AnyChannelType},
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var matched []*subscription
+	for i, key := range keys {
+		duplicate := false // 频道本身是通配值时几个key相同
+		for _, prev := range keys[:i] {
+			duplicate = duplicate || prev == key
+		}
+		if !duplicate {
+			matched = append(matched, s.channels[key]...)
+		}
+	}
+	return matched
+}
+
+// Subscribe 订阅频道收到的消息，channel.ChannelID为AnyChannelID时订阅这个频道类型的所有频道，
+// channel.ChannelType为AnyChannelType时订阅所有类型里这个ChannelID的频道，两个都是通配值时订阅所有频道
+// 同一频道可以有多个订阅，收到消息时依次调用所有匹配的handler(以及SetOnRecv设置的回调)，全部成功后才回执
+// 返回取消订阅的函数，可多次调用
+func (c *Client) Subscribe(channel *Channel, handler OnRecv) (unsubscribe func()) {
+	key := channelKey{channelID: channel.ChannelID, channelType: channel.ChannelType}
+	sub := &subscription{handler: handler}
+	c.subscriptions.add(key, sub)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.subscriptions.remove(key, sub)
+		})
+	}
+}
+
+// 把收到的消息分发给全局回调、所有匹配的订阅和消息流，返回第一个错误
+func (c *Client) dispatchRecv(packet *lmproto.RecvPacket) error {
+	var firstErr error
+	if c.onRecv != nil {
+		firstErr = c.onRecv(packet)
+	}
+	for _, sub := range c.subscriptions.match(packet.ChannelID, packet.ChannelType) {
+		if err := sub.handler(packet); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		c.messages.push(packet)
+	}
+	return firstErr
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribe(t *testing.T) {
+	s := newTestServer(t, nil)
+	c := New(s.addr(), WithUID("1"), WithToken("1234"))
+	recvChan := make(chan string, 16)
+	subscribe := func(name string, channel *Channel, err error) func() {
+		return c.Subscribe(channel, func(packet *lmproto.RecvPacket) error {
+			recvChan <- name
+			return err
+		})
+	}
+	subscribe("exact1", NewChannel("a", 1), nil)
+	unsubscribe := subscribe("exact2", NewChannel("a", 1), nil)
+	subscribe("any", NewChannel(AnyChannelID, 1), nil)
+	subscribe("anyType", NewChannel("a", AnyChannelType), nil)
+	subscribe("all", NewChannel(AnyChannelID, AnyChannelType), nil)
+	subscribe("other", NewChannel("a", 2), nil)
+	subscribe("fail", NewChannel("fail", 1), errors.New("fail"))
+	err := c.Connect()
+	assert.NoError(t, err)
+	defer c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+	<-s.frames // CONNECT
+	conn := <-s.conns
+
+	received := func(n int) []string {
+		names := make([]string, 0, n)
+		for i := 0; i < n; i++ {
+			names = append(names, <-recvChan)
+		}
+		return names
+	}
+
+	s.write(conn, &lmproto.RecvPacket{MessageID: 1, MessageSeq: 1, ChannelID: "a", ChannelType: 1})
+	assert.Equal(t, []string{"exact1", "exact2", "any", "anyType", "all"}, received(5))
+	frame := <-s.frames
+	assert.Equal(t, int64(1), frame.(*lmproto.RecvackPacket).MessageID)
+
+	unsubscribe()
+	unsubscribe()
+	s.write(conn, &lmproto.RecvPacket{MessageID: 2, MessageSeq: 2, ChannelID: "a", ChannelType: 1})
+	assert.Equal(t, []string{"exact1", "any", "anyType", "all"}, received(4))
+	frame = <-s.frames
+	assert.Equal(t, int64(2), frame.(*lmproto.RecvackPacket).MessageID)
+
+	// 有handler失败时不回执，其他handler仍会收到消息
+	s.write(conn, &lmproto.RecvPacket{MessageID: 3, MessageSeq: 3, ChannelID: "fail", ChannelType: 1})
+	assert.Equal(t, []string{"fail", "any", "all"}, received(3))
+	select {
+	case frame := <-s.frames:
+		t.Fatalf("unexpected frame %v", frame)
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	// 其他类型里同一ChannelID的频道
+	s.write(conn, &lmproto.RecvPacket{MessageID: 4, MessageSeq: 4, ChannelID: "a", ChannelType: 2})
+	assert.Equal(t, []string{"other", "anyType", "all"}, received(3))
+}
+
+func TestSubscriptionsMatchWildcardChannel(t *testing.T) {
+	s := newSubscriptions()
+	sub := &subscription{}
+	s.add(channelKey{channelID: AnyChannelID, channelType: AnyChannelType}, sub)
+	// 频道本身是通配值时同一个订阅只匹配一次
+	assert.Len(t, s.match(AnyChannelID, AnyChannelType), 1)
+	assert.Len(t, s.match("a", 1), 1)
+}
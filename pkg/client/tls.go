@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net"
+)
+
+// ErrSPKIPinMismatch 服务端证书链里没有匹配固定公钥的证书
+var ErrSPKIPinMismatch = errors.New("服务端证书的公钥不匹配！")
+
+// TLSOptions tls://连接的配置
+type TLSOptions struct {
+	RootCAs      *x509.CertPool    // 校验服务端证书的根证书，为nil时使用系统根证书
+	Certificates []tls.Certificate // 客户端证书
+	ServerName   string            // 校验服务端证书的域名，为空时使用连接地址的主机名
+	MinVersion   uint16            // 最低的TLS版本，默认TLS1.2
+	// PinnedSPKI 固定的证书公钥(SPKIPin)，不为空时服务端的证书链里必须有一个证书的公钥匹配
+	PinnedSPKI []string
+}
+
+// SPKIPin 证书公钥(SubjectPublicKeyInfo)的SHA256摘要，base64编码
+func SPKIPin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// 生成连接host的tls配置
+func (o *TLSOptions) config(host string) *tls.Config {
+	config := &tls.Config{
+		ServerName: host,
+		MinVersion: tls.VersionTLS12,
+	}
+	if o == nil {
+		return config
+	}
+	config.RootCAs = o.RootCAs
+	config.Certificates = o.Certificates
+	if o.ServerName != "" {
+		config.ServerName = o.ServerName
+	}
+	if o.MinVersion != 0 {
+		config.MinVersion = o.MinVersion
+	}
+	if len(o.PinnedSPKI) > 0 {
+		config.VerifyPeerCertificate = o.verifyPins
+	}
+	return config
+}
+
+// 在证书链校验通过后，校验证书链里是否有匹配的公钥
+func (o *TLSOptions) verifyPins(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	for _, chain := range verifiedChains {
+		for _, cert := range chain {
+			pin := SPKIPin(cert)
+			for _, pinned := range o.PinnedSPKI {
+				if pin == pinned {
+					return nil
+				}
+			}
+		}
+	}
+	return ErrSPKIPinMismatch
+}
+
+// TLSTransport 通过TLS连接的传输层
+type TLSTransport struct {
+	opts   *TLSOptions
+	dialer net.Dialer
+}
+
+// NewTLSTransport 创建TLS传输层，opts为nil时使用系统根证书校验服务端
+func NewTLSTransport(opts *TLSOptions) *TLSTransport {
+	return &TLSTransport{opts: opts}
+}
+
+// Dial 建立TCP连接并完成TLS握手，握手失败时返回Phase为ConnectPhaseTLS的*ConnectError
+func (t *TLSTransport) Dial(ctx context.Context, address string) (Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	rawConn, err := t.dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn := tls.Client(rawConn, t.opts.config(host))
+	unbind := bindContext(ctx, conn.SetDeadline)
+	err = conn.Handshake()
+	if ctxErr := unbind(); err != nil {
+		rawConn.Close()
+		if ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, &ConnectError{Phase: ConnectPhaseTLS, Err: err}
+	}
+	return conn, nil
+}
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试用的证书，parent为nil时是自签名的CA
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, parent *testCert, name string) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key, Leaf: c.cert}
+}
+
+func (c *testCert) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.cert)
+	return pool
+}
+
+// 启动TLS的测试服务端，返回tls://连接地址
+func newTestTLSServer(t *testing.T, config *tls.Config) string {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, nil)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return "tls://" + ln.Addr().String()
+}
+
+func TestTLSTransport(t *testing.T) {
+	ca := newTestCert(t, nil, "LiMao CA")
+	server := newTestCert(t, ca, "im.test")
+	client := newTestCert(t, ca, "1")
+	addr := newTestTLSServer(t, &tls.Config{
+		Certificates: []tls.Certificate{server.tlsCertificate()},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.pool(),
+	})
+
+	c := New(addr, WithUID("1"), WithToken("1234"),
+		WithTLSRootCAs(ca.pool()),
+		WithTLSClientCertificate(client.tlsCertificate()),
+		WithTLSServerName("im.test"),
+		WithTLSMinVersion(tls.VersionTLS12),
+		WithTLSPinnedSPKI(SPKIPin(ca.cert)))
+	err := c.Connect()
+	assert.NoError(t, err)
+	defer c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+
+	err = c.SendMessage(NewChannel("test", 2), []byte("hello"))
+	assert.NoError(t, err)
+}
+
+func TestTLSTransportErrors(t *testing.T) {
+	ca := newTestCert(t, nil, "LiMao CA")
+	server := newTestCert(t, ca, "im.test")
+	addr := newTestTLSServer(t, &tls.Config{Certificates: []tls.Certificate{server.tlsCertificate()}})
+
+	connect := func(addr string, opts ...Option) error {
+		opts = append([]Option{WithUID("1"), WithToken("1234"), WithoutReconnect()}, opts...)
+		return New(addr, opts...).Connect()
+	}
+	var connectErr *ConnectError
+
+	// 不信任的证书
+	err := connect(addr, WithTLSServerName("im.test"))
+	assert.True(t, errors.As(err, &connectErr))
+	assert.Equal(t, ConnectPhaseTLS, connectErr.Phase)
+	assert.True(t, errors.As(err, &x509.UnknownAuthorityError{}))
+
+	// 域名不匹配
+	err = connect(addr, WithTLSRootCAs(ca.pool()), WithTLSServerName("other.test"))
+	assert.True(t, errors.As(err, &connectErr))
+	assert.Equal(t, ConnectPhaseTLS, connectErr.Phase)
+
+	// 公钥不匹配
+	other := newTestCert(t, nil, "Other CA")
+	err = connect(addr, WithTLSRootCAs(ca.pool()), WithTLSServerName("im.test"), WithTLSPinnedSPKI(SPKIPin(other.cert)))
+	assert.True(t, errors.As(err, &connectErr))
+	assert.Equal(t, ConnectPhaseTLS, connectErr.Phase)
+	assert.True(t, errors.Is(err, ErrSPKIPinMismatch))
+
+	// 连接不上
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	ln.Close()
+	err = connect("tls://" + ln.Addr().String())
+	assert.True(t, errors.As(err, &connectErr))
+	assert.Equal(t, ConnectPhaseDial, connectErr.Phase)
+
+	// 服务端拒绝连接
+	s := newTestServer(t, func(s *testServer, conn net.Conn, frame lmproto.Frame) {
+		s.write(conn, &lmproto.ConnackPacket{ReasonCode: lmproto.ReasonAuthFail})
+	})
+	err = connect(s.addr())
+	assert.True(t, errors.As(err, &connectErr))
+	assert.Equal(t, ConnectPhaseConnack, connectErr.Phase)
+
+	assert.Panics(t, func() {
+		New(addr, WithTLSPinnedSPKI("bad pin"))
+	})
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// ConnectPhase 建立连接的阶段
+type ConnectPhase int
+
+const (
+	// ConnectPhaseDial 建立传输层连接
+	ConnectPhaseDial ConnectPhase = iota
+	// ConnectPhaseTLS TLS握手，包括校验服务端证书
+	ConnectPhaseTLS
+	// ConnectPhaseConnack 发送连接包并等待连接回执
+	ConnectPhaseConnack
+)
+
+func (p ConnectPhase) String() string {
+	switch p {
+	case ConnectPhaseDial:
+		return "Dial"
+	case ConnectPhaseTLS:
+		return "TLS"
+	case ConnectPhaseConnack:
+		return "CONNACK"
+	}
+	return fmt.Sprintf("ConnectPhase(%d)", int(p))
+}
+
+// ConnectError 连接失败，Phase为失败的阶段
+type ConnectError struct {
+	Phase ConnectPhase
+	Err   error
+}
+
+func (e *ConnectError) Error() string {
+	return fmt.Sprintf("连接失败[%s]：%v", e.Phase, e.Err)
+}
+
+// Unwrap 失败的原因
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+// 把连接失败的原因包装成*ConnectError，已经包装过的和ctx的错误原样返回
+func connectError(phase ConnectPhase, err error) error {
+	if _, ok := err.(*ConnectError); ok {
+		return err
+	}
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return err
+	}
+	return &ConnectError{Phase: phase, Err: err}
+}
+
+// Conn 传输层连接，读写狸猫协议的字节流
+type Conn interface {
+	io.ReadWriteCloser
+	SetDeadline(t time.Time) error
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// Transport 传输层，按地址建立连接
+type Transport interface {
+	// Dial 连接到address(不含scheme)，ctx的取消和截止时间作用于建立连接的过程
+	Dial(ctx context.Context, address string) (Conn, error)
+}
+
+// TransportFunc 函数形式的Transport
+type TransportFunc func(ctx context.Context, address string) (Conn, error)
+
+// Dial 调用f
+func (f TransportFunc) Dial(ctx context.Context, address string) (Conn, error) {
+	return f(ctx, address)
+}
+
+// NetTransport 用net.Dialer建立连接的传输层，Network为tcp、unix等
+type NetTransport struct {
+	Network string
+	Dialer  net.Dialer
+}
+
+// Dial 建立连接
+func (t *NetTransport) Dial(ctx context.Context, address string) (Conn, error) {
+	return t.Dialer.DialContext(ctx, t.Network, address)
+}
+
+// 解析连接地址，没有scheme时为tcp
+func parseAddr(addr string) (scheme, address string) {
+	if i := strings.Index(addr, "://"); i >= 0 {
+		return strings.ToLower(addr[:i]), addr[i+len("://"):]
+	}
+	return "tcp", addr
+}
+
+// 根据连接地址的scheme选择传输层，配置了Transport时总是使用配置的
+func (c *Client) transport(scheme string) (Transport, error) {
+	if c.opts.Transport != nil {
+		return c.opts.Transport, nil
+	}
+	switch scheme {
+	case "tcp", "unix":
+		return &NetTransport{Network: scheme}, nil
+	case "tls":
+		return NewTLSTransport(c.opts.TLS), nil
+	}
+	return nil, fmt.Errorf("不支持的连接地址[%s]！", c.addr)
+}
+
+// 连接到IM
+func (c *Client) dial(ctx context.Context) (Conn, error) {
+	scheme, address := parseAddr(c.addr)
+	transport, err := c.transport(scheme)
+	if err != nil {
+		return nil, err
+	}
+	return transport.Dial(ctx, address)
+}
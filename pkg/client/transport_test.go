@@ -0,0 +1,80 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAddr(t *testing.T) {
+	scheme, address := parseAddr("TCP://127.0.0.1:7677")
+	assert.Equal(t, "tcp", scheme)
+	assert.Equal(t, "127.0.0.1:7677", address)
+
+	scheme, address = parseAddr("127.0.0.1:7677")
+	assert.Equal(t, "tcp", scheme)
+	assert.Equal(t, "127.0.0.1:7677", address)
+
+	scheme, address = parseAddr("unix:///tmp/LiMao.sock")
+	assert.Equal(t, "unix", scheme)
+	assert.Equal(t, "/tmp/LiMao.sock", address)
+}
+
+func TestPipeTransport(t *testing.T) {
+	s := newTestServer(t, nil)
+	var dialed string
+	transport := TransportFunc(func(ctx context.Context, address string) (Conn, error) {
+		dialed = address
+		client, server := net.Pipe()
+		s.serve(server)
+		return client, nil
+	})
+	c := New("pipe://im", WithUID("1"), WithToken("1234"), WithTransport(transport))
+	err := c.Connect()
+	assert.NoError(t, err)
+	defer c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+	assert.Equal(t, "im", dialed)
+
+	err = c.SendMessage(NewChannel("test", 2), []byte("hello"))
+	assert.NoError(t, err)
+}
+
+func TestUnixTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transport")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "im.sock")
+	ln, err := net.Listen("unix", path)
+	assert.NoError(t, err)
+	s := newTestServer(t, nil)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.serve(conn)
+		}
+	}()
+	defer ln.Close()
+
+	c := New("unix://"+path, WithUID("1"), WithToken("1234"))
+	err = c.Connect()
+	assert.NoError(t, err)
+	defer c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+	err = c.SendMessage(NewChannel("test", 2), []byte("hello"))
+	assert.NoError(t, err)
+}
+
+func TestUnsupportedTransport(t *testing.T) {
+	c := New("ws://127.0.0.1:7677", WithUID("1"), WithToken("1234"), WithoutReconnect())
+	err := c.Connect()
+	assert.Error(t, err)
+	assert.Equal(t, StateIdle, c.State())
+}
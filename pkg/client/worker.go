@@ -0,0 +1,80 @@
+package client
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+)
+
+// 处理队列里的一条消息
+type recvTask struct {
+	packet     *lmproto.RecvPacket
+	enqueuedAt time.Time
+}
+
+// 并发处理收到的消息，同一频道的消息总是交给同一个worker，保证频道内的顺序
+type recvWorkers struct {
+	queues    []chan recvTask // 每个worker一个队列
+	handle    func(packet *lmproto.RecvPacket) error
+	wait      *histogram    // 在队列里等待的时间
+	done      chan struct{} // 客户端关闭
+	startOnce sync.Once
+}
+
+func newRecvWorkers(workers, queueSize int, handle func(packet *lmproto.RecvPacket) error, wait *histogram, done chan struct{}) *recvWorkers {
+	w := &recvWorkers{
+		queues: make([]chan recvTask, workers),
+		handle: handle,
+		wait:   wait,
+		done:   done,
+	}
+	for i := range w.queues {
+		w.queues[i] = make(chan recvTask, queueSize)
+	}
+	return w
+}
+
+// 把消息放入所属频道的队列，队列满时阻塞，客户端关闭后丢弃
+func (w *recvWorkers) submit(packet *lmproto.RecvPacket) {
+	w.startOnce.Do(w.start)
+	select {
+	case w.queues[channelIndex(packet.ChannelID, packet.ChannelType, len(w.queues))] <- recvTask{packet: packet, enqueuedAt: time.Now()}:
+	case <-w.done:
+	}
+}
+
+// 第一次提交时启动worker，客户端关闭后退出，队列里没处理的消息没有回执，服务端会重新投递
+func (w *recvWorkers) start() {
+	for _, queue := range w.queues {
+		go func(queue chan recvTask) {
+			for {
+				select {
+				case task := <-queue:
+					w.wait.observe(time.Since(task.enqueuedAt))
+					w.handle(task.packet)
+				case <-w.done:
+					return
+				}
+			}
+		}(queue)
+	}
+}
+
+// 所有队列里等待的消息数
+func (w *recvWorkers) queued() int {
+	n := 0
+	for _, queue := range w.queues {
+		n += len(queue)
+	}
+	return n
+}
+
+// 频道对应的worker
+func channelIndex(channelID string, channelType uint8, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte{channelType})
+	h.Write([]byte(channelID))
+	return int(h.Sum32() % uint32(n))
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lim-team/LiMaoCLIGo/pkg/lmproto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecvWorkers(t *testing.T) {
+	s := newTestServer(t, nil)
+	c := New(s.addr(), WithUID("1"), WithToken("1234"), WithRecvWorkers(4, 16))
+	var (
+		lock     sync.Mutex
+		received = map[string][]int64{}
+		wg       sync.WaitGroup
+	)
+	slow := make(chan struct{})
+	c.SetOnRecv(func(packet *lmproto.RecvPacket) error {
+		if packet.ChannelID == "slow" {
+			<-slow
+		}
+		lock.Lock()
+		received[packet.ChannelID] = append(received[packet.ChannelID], packet.MessageID)
+		lock.Unlock()
+		wg.Done()
+		return nil
+	})
+	err := c.Connect()
+	assert.NoError(t, err)
+	defer c.Disconnect(context.Background(), lmproto.ReasonSuccess, "")
+	conn := <-s.conns
+
+	// 慢的频道不影响其他频道，同一频道内按顺序处理
+	channels := []string{"slow"}
+	for _, channelID := range []string{"a", "b", "c", "d", "e", "f"} {
+		if channelIndex(channelID, 1, 4) != channelIndex("slow", 1, 4) {
+			channels = append(channels, channelID)
+		}
+	}
+	messageID := int64(0)
+	for i := 0; i < 5; i++ {
+		for _, channelID := range channels {
+			messageID++
+			wg.Add(1)
+			s.write(conn, &lmproto.RecvPacket{MessageID: messageID, MessageSeq: uint32(messageID), ChannelID: channelID, ChannelType: 1})
+		}
+	}
+	time.Sleep(time.Millisecond * 50)
+	lock.Lock()
+	assert.Len(t, received["slow"], 0)
+	for _, channelID := range channels[1:] {
+		assert.Len(t, received[channelID], 5)
+	}
+	lock.Unlock()
+	assert.Equal(t, 4, c.Stats().RecvQueued) // 第一条消息正在处理
+
+	close(slow)
+	wg.Wait()
+	for _, channelID := range channels {
+		ids := received[channelID]
+		for i := 1; i < len(ids); i++ {
+			assert.True(t, ids[i] > ids[i-1], "channel %s out of order: %v", channelID, ids)
+		}
+	}
+	stats := c.Stats()
+	assert.Equal(t, int64(5*len(channels)), stats.RecvQueueWait.Count)
+	assert.Equal(t, 0, stats.RecvQueued)
+}
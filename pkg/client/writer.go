@@ -0,0 +1,256 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// 一次合并写入最多包含的请求数
+const maxWriteBatch = 128
+
+// 一次合并写入最多包含的字节数(至少包含一个请求)，限制高优先级的包等待的时间
+const maxWriteBatchBytes = 64 * 1024
+
+// Priority 写入连接的优先级，写入者总是先写高优先级通道里的包
+type Priority int
+
+const (
+	// PriorityControl 控制包(ping、回执、断开等)
+	PriorityControl Priority = iota
+	// PriorityInteractive 交互消息，发送消息的默认优先级
+	PriorityInteractive
+	// PriorityBulk 大批量消息
+	PriorityBulk
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityControl:
+		return "Control"
+	case PriorityInteractive:
+		return "Interactive"
+	case PriorityBulk:
+		return "Bulk"
+	}
+	return fmt.Sprintf("Priority(%d)", int(p))
+}
+
+// 写入请求
+type writeRequest struct {
+	ctx    context.Context
+	data   [][]byte   // 编码后的包
+	result chan error // 写入结果
+	size   int        // 数据的字节数
+}
+
+// 连接的写入者，每个连接一个goroutine按优先级和顺序写入，把队列里的多个请求合并成一次写入(writev)
+type connWriter struct {
+	conn   Conn
+	lanes  [PriorityBulk + 1]chan *writeRequest // 每个优先级一个队列
+	stop   chan struct{}                        // 通知写入goroutine退出
+	exited chan struct{}                        // 写入goroutine已退出
+}
+
+func newConnWriter(conn Conn, queueSize int) *connWriter {
+	w := &connWriter{
+		conn:   conn,
+		stop:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+	for i := range w.lanes {
+		w.lanes[i] = make(chan *writeRequest, queueSize)
+	}
+	go w.loop()
+	return w
+}
+
+// 写入包，队列满时阻塞，ctx结束或连接断开时返回
+// ctx在写入前结束时不会写入；有截止时间时会设置为连接的写入截止时间
+func (w *connWriter) write(ctx context.Context, priority Priority, data [][]byte) error {
+	req := &writeRequest{
+		ctx:    ctx,
+		data:   data,
+		result: make(chan error, 1),
+	}
+	for _, d := range data {
+		req.size += len(d)
+	}
+	select {
+	case w.lanes[priority] <- req:
+	case <-w.exited:
+		return ErrNotConnected
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-req.result:
+		return err
+	case <-w.exited:
+		select { // 退出前可能已经写入
+		case err := <-req.result:
+			return err
+		default:
+			return ErrNotConnected
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 停止写入，还在队列里的请求返回ErrNotConnected
+func (w *connWriter) close() {
+	select {
+	case <-w.stop:
+	default:
+		close(w.stop)
+	}
+}
+
+func (w *connWriter) loop() {
+	defer close(w.exited)
+	var pending []*writeRequest // 上次没有写入的请求
+	for {
+		if len(pending) == 0 {
+			if req := w.next(); req != nil { // 多个队列都有请求时select是随机的，先按优先级取
+				pending = append(pending, req)
+			}
+		}
+		if len(pending) == 0 {
+			select {
+			case req := <-w.lanes[PriorityControl]:
+				pending = append(pending, req)
+			case req := <-w.lanes[PriorityInteractive]:
+				pending = append(pending, req)
+			case req := <-w.lanes[PriorityBulk]:
+				pending = append(pending, req)
+			case <-w.stop:
+				w.drain()
+				return
+			}
+		}
+		pending = w.writeBatch(w.collect(pending))
+	}
+}
+
+// 按优先级从队列里取出请求加入这一批，直到没有请求或者达到一次写入的上限
+func (w *connWriter) collect(batch []*writeRequest) []*writeRequest {
+	size := 0
+	for _, req := range batch {
+		size += req.size
+	}
+	for len(batch) < maxWriteBatch && size < maxWriteBatchBytes {
+		req := w.next()
+		if req == nil {
+			break
+		}
+		batch = append(batch, req)
+		size += req.size
+	}
+	return batch
+}
+
+// 不阻塞地取出优先级最高的请求，没有时返回nil
+func (w *connWriter) next() *writeRequest {
+	for _, lane := range w.lanes {
+		select {
+		case req := <-lane:
+			return req
+		default:
+		}
+	}
+	return nil
+}
+
+// 合并写入一批请求，返回因为其他请求的截止时间而没有写入的请求
+func (w *connWriter) writeBatch(batch []*writeRequest) []*writeRequest {
+	var (
+		buffers  net.Buffers
+		total    int
+		deadline time.Time
+		active   = batch[:0]
+	)
+	for _, req := range batch {
+		if err := req.ctx.Err(); err != nil {
+			req.result <- err
+			continue
+		}
+		if d, ok := req.ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+			deadline = d
+		}
+		for _, data := range req.data {
+			buffers = append(buffers, data)
+			total += len(data)
+		}
+		active = append(active, req)
+	}
+	if len(active) == 0 {
+		return nil
+	}
+	w.conn.SetWriteDeadline(deadline)
+	n, err := writeBuffers(w.conn, buffers, total)
+	if !deadline.IsZero() {
+		w.conn.SetWriteDeadline(time.Time{})
+	}
+	if err == nil {
+		for _, req := range active {
+			req.result <- nil
+		}
+		return nil
+	}
+	if n > 0 && n < int64(total) {
+		w.conn.Close() // 只写入了部分数据，连接上的数据流已不完整，关闭后让其重连
+	}
+	var retry []*writeRequest
+	for _, req := range active {
+		if ctxErr := contextErr(req.ctx); ctxErr != nil {
+			req.result <- ctxErr
+		} else if n == 0 && isTimeout(err) { // 其他请求的截止时间到了，还没写入任何数据，下次再写
+			retry = append(retry, req)
+		} else {
+			req.result <- err
+		}
+	}
+	return retry
+}
+
+// 写入一批数据，连接支持writev时直接写入，否则(如*tls.Conn)拼成一个buffer写一次，避免每个包一次系统调用和一个TLS记录
+func writeBuffers(conn Conn, buffers net.Buffers, total int) (int64, error) {
+	switch conn.(type) {
+	case *net.TCPConn, *net.UnixConn:
+		return buffers.WriteTo(conn)
+	}
+	data := buffers[0]
+	if len(buffers) > 1 {
+		data = make([]byte, 0, total)
+		for _, b := range buffers {
+			data = append(data, b...)
+		}
+	}
+	n, err := conn.Write(data)
+	return int64(n), err
+}
+
+// 退出前让队列里的请求返回
+func (w *connWriter) drain() {
+	for req := w.next(); req != nil; req = w.next() {
+		req.result <- ErrNotConnected
+	}
+}
+
+// ctx的错误，截止时间已过但ctx还没有结束时返回context.DeadlineExceeded
+func contextErr(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 记录写入的连接，gate不为nil时每次写入等待gate
+type recordConn struct {
+	net.Conn
+	lock    sync.Mutex
+	writes  []string
+	batches int // 合并写入的次数(每次写入前设置一次截止时间)
+	gate    chan struct{}
+	err     error
+}
+
+func (r *recordConn) Write(b []byte) (int, error) {
+	if r.gate != nil {
+		<-r.gate
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.err != nil {
+		return 0, r.err
+	}
+	r.writes = append(r.writes, string(b))
+	return len(b), nil
+}
+
+func (r *recordConn) SetWriteDeadline(t time.Time) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if t.IsZero() {
+		return nil
+	}
+	r.batches++
+	return nil
+}
+
+func (r *recordConn) Close() error {
+	return nil
+}
+
+func TestConnWriterCoalesce(t *testing.T) {
+	conn := &recordConn{gate: make(chan struct{})}
+	w := newConnWriter(conn, 16)
+	defer w.close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	write := func(data ...string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buffers := make([][]byte, len(data))
+			for i, d := range data {
+				buffers[i] = []byte(d)
+			}
+			assert.NoError(t, w.write(ctx, PriorityInteractive, buffers))
+		}()
+	}
+	// 第一次写入阻塞时后面的请求在队列里等待，之后合并成一次写入
+	write("a")
+	time.Sleep(time.Millisecond * 20)
+	write("b", "c")
+	write("d")
+	time.Sleep(time.Millisecond * 20)
+	close(conn.gate)
+	wg.Wait()
+
+	assert.Equal(t, 2, conn.batches)
+	// 连接不支持writev，一批只调用一次Write
+	assert.Len(t, conn.writes, 2)
+	assert.Equal(t, "a", conn.writes[0])
+	assert.ElementsMatch(t, []byte("bcd"), []byte(conn.writes[1]))
+}
+
+func TestConnWriterError(t *testing.T) {
+	errBroken := errors.New("broken pipe")
+	conn := &recordConn{err: errBroken}
+	w := newConnWriter(conn, 16)
+	assert.Equal(t, errBroken, w.write(context.Background(), PriorityInteractive, [][]byte{[]byte("a")}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, w.write(ctx, PriorityInteractive, [][]byte{[]byte("a")}))
+
+	w.close()
+	<-w.exited
+	assert.Equal(t, ErrNotConnected, w.write(context.Background(), PriorityInteractive, [][]byte{[]byte("a")}))
+}
+
+func TestConnWriterPriority(t *testing.T) {
+	conn := &recordConn{gate: make(chan struct{})}
+	w := newConnWriter(conn, 16)
+	defer w.close()
+
+	var wg sync.WaitGroup
+	write := func(priority Priority, data string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, w.write(context.Background(), priority, [][]byte{[]byte(data)}))
+		}()
+		time.Sleep(time.Millisecond * 20)
+	}
+	// 第一次写入阻塞时，控制包排在先进入队列的大批量消息前面
+	write(PriorityInteractive, "a")
+	write(PriorityBulk, "bulk")
+	write(PriorityInteractive, "message")
+	write(PriorityControl, "ping")
+	close(conn.gate)
+	wg.Wait()
+
+	assert.Equal(t, []string{"a", "pingmessagebulk"}, conn.writes)
+	assert.Equal(t, "Bulk", PriorityBulk.String())
+}
+
+func TestWriteBuffers(t *testing.T) {
+	conn := &recordConn{}
+	n, err := writeBuffers(conn, net.Buffers{[]byte("ab"), []byte("c")}, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	assert.Equal(t, []string{"abc"}, conn.writes)
+}